@@ -1,6 +1,7 @@
 package requests
 
 import (
+	"context"
 	"github.com/wangluozhe/chttp"
 	"github.com/wangluozhe/requests/models"
 	"github.com/wangluozhe/requests/url"
@@ -10,6 +11,10 @@ func Request(method, rawurl string, req *url.Request) (*models.Response, error)
 	return defaultSession.Request(method, rawurl, req)
 }
 
+func RequestWithContext(ctx context.Context, method, rawurl string, req *url.Request) (*models.Response, error) {
+	return defaultSession.RequestWithContext(ctx, method, rawurl, req)
+}
+
 func Get(rawurl string, req *url.Request) (*models.Response, error) {
 	return Request(http.MethodGet, rawurl, req)
 }
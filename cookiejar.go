@@ -0,0 +1,312 @@
+package requests
+
+import (
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/chttp/cookiejar"
+	"net"
+	url2 "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 记录写入Jar的Cookie，实现http.CookieJar。
+// chttp的cookiejar没有提供遍历Cookie的方法，导出、删除与修改Cookie都依赖该记录，
+// 直接调用Session.Cookies.SetCookies写入的Cookie不会被记录
+type cookieStore struct {
+	mutex   sync.Mutex
+	jar     *cookiejar.Jar
+	entries map[cookieKey]*storedCookie
+	seq     uint64
+}
+
+// 与cookiejar相同，域名、路径与名称都相同的Cookie视为同一个
+type cookieKey struct {
+	domain, path, name string
+}
+
+type storedCookie struct {
+	Cookie
+	seq uint64 // 首次写入的顺序，覆盖时保持不变
+}
+
+func newCookieStore(jar *cookiejar.Jar) *cookieStore {
+	return &cookieStore{jar: jar, entries: make(map[cookieKey]*storedCookie)}
+}
+
+// 写入Jar并记录被接受的Cookie，域名、路径与过期时间按cookiejar的规则计算
+func (c *cookieStore) SetCookies(u *url2.URL, cookies []*http.Cookie) {
+	if len(cookies) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.jar.SetCookies(u, cookies)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	now := time.Now()
+	for _, cookie := range cookies {
+		domain, hostOnly, ok := cookieDomain(host, cookie.Domain)
+		if !ok {
+			continue
+		}
+		path := cookie.Path
+		if path == "" || path[0] != '/' {
+			path = defaultCookiePath(u.Path)
+		}
+		key := cookieKey{domain: domain, path: path, name: cookie.Name}
+		expires, ok := cookieExpires(cookie, now)
+		if !ok {
+			delete(c.entries, key)
+			continue
+		}
+		if !c.accepted(key, cookie.Value) {
+			continue
+		}
+		stored := &storedCookie{Cookie: Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   domain,
+			Path:     path,
+			Expires:  expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: sameSiteName(cookie.SameSite),
+			HostOnly: hostOnly,
+		}}
+		if old, ok := c.entries[key]; ok {
+			stored.seq = old.seq
+		} else {
+			c.seq++
+			stored.seq = c.seq
+		}
+		c.entries[key] = stored
+	}
+}
+
+func (c *cookieStore) Cookies(u *url2.URL) []*http.Cookie {
+	return c.jar.Cookies(u)
+}
+
+// 确认Jar接受了Cookie，cookiejar会拒绝域名不匹配或属于公共后缀的Cookie
+func (c *cookieStore) accepted(key cookieKey, value string) bool {
+	for _, cookie := range c.jar.Cookies(cookieURL(key.domain, key.path)) {
+		if cookie.Name == key.name && cookie.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// 全部未过期的Cookie，按域名、路径与写入顺序排列
+func (c *cookieStore) all() []*Cookie {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	entries := make([]*storedCookie, 0, len(c.entries))
+	for key, e := range c.entries {
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			delete(c.entries, key)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, k int) bool {
+		a, b := entries[i], entries[k]
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.seq < b.seq
+	})
+	cookies := make([]*Cookie, len(entries))
+	for i, e := range entries {
+		cookie := e.Cookie
+		cookies[i] = &cookie
+	}
+	return cookies
+}
+
+// 写入Cookie，忽略域名或名称为空及被Jar拒绝的Cookie
+func (c *cookieStore) set(cookies []*Cookie) {
+	for _, cookie := range cookies {
+		c.add(cookie)
+	}
+}
+
+// 写入一个Cookie，已过期的Cookie会删除同名的Cookie，Cookie不合法或被Jar拒绝时返回错误
+func (c *cookieStore) add(cookie *Cookie) error {
+	host := canonicalDomain(cookie.Domain)
+	if host == "" {
+		return fmt.Errorf("cookie %q has no domain", cookie.Name)
+	}
+	if !validCookieDomain(host) {
+		return fmt.Errorf("cookie %q has invalid domain %q", cookie.Name, cookie.Domain)
+	}
+	if cookie.Name == "" {
+		return fmt.Errorf("cookie for %q has no name", host)
+	}
+	path := cookie.Path
+	if path == "" {
+		path = "/"
+	}
+	httpCookie := toHTTPCookie(cookie, host, path)
+	c.SetCookies(cookieURL(host, path), []*http.Cookie{httpCookie})
+	if httpCookie.MaxAge < 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[cookieKey{domain: host, path: path, name: cookie.Name}]; !ok {
+		return fmt.Errorf("cookie %q for domain %q was rejected by the cookie jar", cookie.Name, host)
+	}
+	return nil
+}
+
+// 删除满足match的Cookie，返回删除的数量
+func (c *cookieStore) remove(match func(*Cookie) bool) int {
+	n := 0
+	for _, cookie := range c.all() {
+		if match(cookie) {
+			cookie.Expires = time.Unix(1, 0)
+			c.SetCookies(cookieURL(cookie.Domain, cookie.Path), []*http.Cookie{toHTTPCookie(cookie, cookie.Domain, cookie.Path)})
+			n++
+		}
+	}
+	return n
+}
+
+// 修改满足match的Cookie的过期时间，重新写入Jar，返回修改的数量
+func (c *cookieStore) expire(match func(*Cookie) bool, expires time.Time) int {
+	n := 0
+	for _, cookie := range c.all() {
+		if match(cookie) {
+			cookie.Expires = expires
+			c.SetCookies(cookieURL(cookie.Domain, cookie.Path), []*http.Cookie{toHTTPCookie(cookie, cookie.Domain, cookie.Path)})
+			n++
+		}
+	}
+	return n
+}
+
+// 转换为写入Jar的Cookie，已过期时设置MaxAge为-1，由Jar删除
+func toHTTPCookie(c *Cookie, host, path string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	if !c.HostOnly {
+		cookie.Domain = host
+	}
+	if !c.Expires.IsZero() && !c.Expires.After(time.Now()) {
+		cookie.MaxAge = -1
+	}
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// 能取回domain与path下Cookie的地址，使用https以包含Secure的Cookie
+func cookieURL(domain, path string) *url2.URL {
+	return &url2.URL{Scheme: "https", Host: domain, Path: path}
+}
+
+// 按cookiejar的规则计算Cookie的域名，返回是否只发送给该主机及是否合法
+func cookieDomain(host, domain string) (string, bool, bool) {
+	if domain == "" {
+		return host, true, host != ""
+	}
+	if net.ParseIP(host) != nil {
+		return host, true, domain == host
+	}
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" || domain[0] == '.' || domain[len(domain)-1] == '.' {
+		return "", false, false
+	}
+	if host != domain && !strings.HasSuffix(host, "."+domain) {
+		return "", false, false
+	}
+	return domain, false, true
+}
+
+// 域名是否为IP或由字母、数字、"-"与"_"组成的非空标签，chttp会丢弃不合法的Domain属性
+func validCookieDomain(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return true
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 按cookiejar的规则计算默认路径，即请求路径中最后一个"/"之前的部分
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// 按cookiejar的规则计算过期时间，零值为会话Cookie，Cookie已过期时返回false
+func cookieExpires(cookie *http.Cookie, now time.Time) (time.Time, bool) {
+	if cookie.MaxAge < 0 {
+		return time.Time{}, false
+	}
+	if cookie.MaxAge > 0 {
+		return now.Add(time.Duration(cookie.MaxAge) * time.Second), true
+	}
+	if cookie.Expires.IsZero() {
+		return time.Time{}, true
+	}
+	return cookie.Expires, cookie.Expires.After(now)
+}
+
+func sameSiteName(sameSite http.SameSite) string {
+	switch sameSite {
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+// 获取记录Session Cookie的cookieStore，s.Cookies被替换后重新创建，之前的记录不再使用
+func (s *Session) cookieStore() *cookieStore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Cookies == nil {
+		s.Cookies, _ = cookiejar.New(nil)
+	}
+	if s.cookies == nil || s.cookies.jar != s.Cookies {
+		s.cookies = newCookieStore(s.Cookies)
+	}
+	return s.cookies
+}
@@ -0,0 +1,467 @@
+package requests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie的导入导出格式
+type CookieFormat int
+
+const (
+	CookieJSON     CookieFormat = iota // Cookie结构体的JSON数组
+	CookieNetscape                     // Netscape cookies.txt，curl、wget与浏览器扩展使用，不包含SameSite
+	CookieBrowser                      // EditThisCookie扩展与Chrome DevTools导出的JSON数组，导出为EditThisCookie格式
+)
+
+// Jar中保存的Cookie
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitzero"` // 零值为会话Cookie
+	Secure   bool      `json:"secure"`
+	HttpOnly bool      `json:"httpOnly"`
+	SameSite string    `json:"sameSite,omitempty"` // Strict、Lax或None，为空时未设置
+	HostOnly bool      `json:"hostOnly"`           // 为true时只发送给Domain本身，不发送给子域名
+}
+
+// 将Session中的全部Cookie按格式写入w
+func (s *Session) ExportCookies(w io.Writer, format CookieFormat) error {
+	cookies := s.cookieStore().all()
+	switch format {
+	case CookieJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cookies)
+	case CookieNetscape:
+		return writeNetscapeCookies(w, cookies)
+	case CookieBrowser:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(toBrowserCookies(cookies))
+	}
+	return fmt.Errorf("unsupported cookie format: %d", format)
+}
+
+// 从r中按格式读取Cookie并合并到Session，同名Cookie会被覆盖，设置了PersistCookies时会自动保存
+func (s *Session) ImportCookies(r io.Reader, format CookieFormat) error {
+	cookies, err := decodeCookies(r, format)
+	if err != nil {
+		return err
+	}
+	s.cookieStore().set(cookies)
+	s.autoSaveCookies()
+	return nil
+}
+
+func decodeCookies(r io.Reader, format CookieFormat) ([]*Cookie, error) {
+	var cookies []*Cookie
+	var err error
+	switch format {
+	case CookieJSON:
+		err = json.NewDecoder(r).Decode(&cookies)
+	case CookieNetscape:
+		cookies, err = readNetscapeCookies(r)
+	case CookieBrowser:
+		var browser []*browserCookie
+		if err = json.NewDecoder(r).Decode(&browser); err == nil {
+			cookies = fromBrowserCookies(browser)
+		}
+	default:
+		err = fmt.Errorf("unsupported cookie format: %d", format)
+	}
+	return cookies, err
+}
+
+// 将Session中的全部Cookie保存到文件，先写入临时文件再替换，文件权限为0600
+func (s *Session) SaveCookies(path string, format CookieFormat) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	w := bufio.NewWriter(file)
+	if err = s.ExportCookies(w, format); err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// 从文件中读取Cookie并合并到Session
+func (s *Session) LoadCookies(path string, format CookieFormat) error {
+	cookies, err := readCookieFile(path, format)
+	if err != nil {
+		return err
+	}
+	s.cookieStore().set(cookies)
+	s.autoSaveCookies()
+	return nil
+}
+
+func readCookieFile(path string, format CookieFormat) ([]*Cookie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeCookies(bufio.NewReader(file), format)
+}
+
+// Cookie变化后延迟保存的时间，期间的修改合并为一次保存
+const cookieSaveDelay = time.Second
+
+// 自动保存Cookie的文件
+type cookieFile struct {
+	mutex   sync.Mutex
+	path    string
+	format  CookieFormat
+	timer   *time.Timer
+	pending bool  // 是否有尚未保存的修改
+	err     error // 最近一次保存的错误
+}
+
+// 立即保存尚未保存的Cookie，返回最近一次保存的错误
+func (f *cookieFile) flush(s *Session) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.pending {
+		f.pending = false
+		f.err = s.SaveCookies(f.path, f.format)
+	}
+	return f.err
+}
+
+// 使用文件持久化Session的Cookie，文件存在时先读取，之后收到Set-Cookie或通过CookieJar、ImportCookies修改Cookie时自动保存到文件，
+// 保存会延迟cookieSaveDelay以合并连续的写入，退出前需调用FlushCookies或Close。path为空时停止保存
+func (s *Session) PersistCookies(path string, format CookieFormat) error {
+	if path == "" {
+		if f := s.cookieFile.Swap(nil); f != nil {
+			return f.flush(s)
+		}
+		return nil
+	}
+	// 读取的Cookie马上会保存到新文件，不触发之前文件的自动保存
+	cookies, err := readCookieFile(path, format)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.cookieStore().set(cookies)
+	if err := s.SaveCookies(path, format); err != nil {
+		return err
+	}
+	if f := s.cookieFile.Swap(&cookieFile{path: path, format: format}); f != nil {
+		return f.flush(s)
+	}
+	return nil
+}
+
+// 立即保存PersistCookies设置的文件中尚未保存的Cookie，返回最近一次保存的错误，未设置时返回nil
+func (s *Session) FlushCookies() error {
+	if f := s.cookieFile.Load(); f != nil {
+		return f.flush(s)
+	}
+	return nil
+}
+
+// Cookie变化后调用，设置了PersistCookies时在cookieSaveDelay后保存Cookie，保存失败不影响请求，错误由FlushCookies返回
+func (s *Session) autoSaveCookies() {
+	f := s.cookieFile.Load()
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.pending = true
+	if f.timer == nil {
+		f.timer = time.AfterFunc(cookieSaveDelay, func() {
+			f.flush(s)
+		})
+	}
+}
+
+// Netscape cookies.txt中HttpOnly的Cookie以该前缀开头
+const netscapeHttpOnlyPrefix = "#HttpOnly_"
+
+func writeNetscapeCookies(w io.Writer, cookies []*Cookie) error {
+	if _, err := io.WriteString(w, "# Netscape HTTP Cookie File\n\n"); err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+		if c.HttpOnly {
+			domain = netscapeHttpOnlyPrefix + domain
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, netscapeBool(!c.HostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func readNetscapeCookies(r io.Reader) ([]*Cookie, error) {
+	var cookies []*Cookie
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, netscapeHttpOnlyPrefix)
+		line = strings.TrimPrefix(line, netscapeHttpOnlyPrefix)
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("netscape cookie line %d: expected 7 tab-separated fields, got %d", n, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("netscape cookie line %d: invalid expiry %q", n, fields[4])
+		}
+		c := &Cookie{
+			Domain:   fields[0],
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+// EditThisCookie与Chrome DevTools导出的Cookie，DevTools使用expires且会话Cookie为-1
+type browserCookie struct {
+	Domain         string   `json:"domain"`
+	ExpirationDate float64  `json:"expirationDate,omitempty"`
+	Expires        *float64 `json:"expires,omitempty"`
+	HostOnly       *bool    `json:"hostOnly,omitempty"`
+	HttpOnly       bool     `json:"httpOnly"`
+	Name           string   `json:"name"`
+	Path           string   `json:"path"`
+	SameSite       string   `json:"sameSite"`
+	Secure         bool     `json:"secure"`
+	Session        bool     `json:"session"`
+	StoreId        string   `json:"storeId,omitempty"`
+	Value          string   `json:"value"`
+}
+
+func fromBrowserCookies(browser []*browserCookie) []*Cookie {
+	cookies := make([]*Cookie, 0, len(browser))
+	for _, b := range browser {
+		c := &Cookie{
+			Name:     b.Name,
+			Value:    b.Value,
+			Domain:   b.Domain,
+			Path:     b.Path,
+			Secure:   b.Secure,
+			HttpOnly: b.HttpOnly,
+			HostOnly: !strings.HasPrefix(b.Domain, "."),
+		}
+		if b.HostOnly != nil {
+			c.HostOnly = *b.HostOnly
+		}
+		expires := b.ExpirationDate
+		if b.Expires != nil {
+			expires = *b.Expires
+		}
+		if !b.Session && expires > 0 {
+			sec, frac := math.Modf(expires)
+			c.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		switch strings.ToLower(b.SameSite) {
+		case "strict":
+			c.SameSite = "Strict"
+		case "lax":
+			c.SameSite = "Lax"
+		case "none", "no_restriction":
+			c.SameSite = "None"
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
+
+func toBrowserCookies(cookies []*Cookie) []*browserCookie {
+	browser := make([]*browserCookie, 0, len(cookies))
+	for _, c := range cookies {
+		hostOnly := c.HostOnly
+		b := &browserCookie{
+			Domain:   c.Domain,
+			HostOnly: &hostOnly,
+			HttpOnly: c.HttpOnly,
+			Name:     c.Name,
+			Path:     c.Path,
+			SameSite: "unspecified",
+			Secure:   c.Secure,
+			Session:  c.Expires.IsZero(),
+			StoreId:  "0",
+			Value:    c.Value,
+		}
+		if !hostOnly {
+			b.Domain = "." + b.Domain
+		}
+		if !b.Session {
+			b.ExpirationDate = float64(c.Expires.UnixNano()) / 1e9
+		}
+		switch c.SameSite {
+		case "Strict":
+			b.SameSite = "strict"
+		case "Lax":
+			b.SameSite = "lax"
+		case "None":
+			b.SameSite = "no_restriction"
+		}
+		browser = append(browser, b)
+	}
+	return browser
+}
+
+// 查看与修改Session中的Cookie，通过Session.CookieJar获取
+type CookieJar struct {
+	session *Session
+}
+
+// 获取Session Cookie的查看与修改接口
+func (s *Session) CookieJar() *CookieJar {
+	return &CookieJar{session: s}
+}
+
+// 去掉域名开头的点并转为小写
+func canonicalDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(domain, "."))
+}
+
+// Cookie的域名是否为domain或其子域名
+func inDomain(cookieDomain, domain string) bool {
+	return domain == "" || cookieDomain == domain || strings.HasSuffix(cookieDomain, "."+domain)
+}
+
+// 获取全部Cookie，按域名、路径与创建顺序排列
+func (j *CookieJar) All() []*Cookie {
+	return j.session.cookieStore().all()
+}
+
+// 获取域名为domain及其子域名的Cookie
+func (j *CookieJar) ForDomain(domain string) []*Cookie {
+	domain = canonicalDomain(domain)
+	var matched []*Cookie
+	for _, c := range j.All() {
+		if inDomain(c.Domain, domain) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// 获取域名为domain、名称为name的Cookie，存在多个路径时返回路径最短的，不存在时返回nil
+func (j *CookieJar) Get(name, domain string) *Cookie {
+	domain = canonicalDomain(domain)
+	var matched *Cookie
+	for _, c := range j.All() {
+		if c.Name == name && c.Domain == domain && (matched == nil || len(c.Path) < len(matched.Path)) {
+			matched = c
+		}
+	}
+	return matched
+}
+
+// 设置Cookie，不需要URL，Domain必须设置，Path为空时为"/"，设置的Cookie会发送给Domain及其子域名。
+// Domain或Name为空以及Cookie被Jar拒绝时返回错误
+func (j *CookieJar) Set(cookie *http.Cookie) error {
+	c := &Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   cookie.Domain,
+		Path:     cookie.Path,
+		Expires:  cookie.Expires,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: sameSiteName(cookie.SameSite),
+	}
+	if cookie.MaxAge < 0 {
+		c.Expires = time.Unix(1, 0)
+	} else if cookie.MaxAge > 0 {
+		c.Expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+	}
+	if err := j.session.cookieStore().add(c); err != nil {
+		return err
+	}
+	j.session.autoSaveCookies()
+	return nil
+}
+
+// 删除域名为domain、名称为name的Cookie，包括全部路径，返回删除的数量
+func (j *CookieJar) Delete(name, domain string) int {
+	domain = canonicalDomain(domain)
+	return j.changed(j.session.cookieStore().remove(func(c *Cookie) bool {
+		return c.Name == name && c.Domain == domain
+	}))
+}
+
+// 删除域名为domain及其子域名的Cookie，domain为空时删除全部Cookie，返回删除的数量
+func (j *CookieJar) Clear(domain string) int {
+	domain = canonicalDomain(domain)
+	return j.changed(j.session.cookieStore().remove(func(c *Cookie) bool {
+		return inDomain(c.Domain, domain)
+	}))
+}
+
+// 修改域名为domain、名称为name的Cookie的过期时间，expires为零值时改为会话Cookie，早于当前时间时删除，返回修改的数量
+func (j *CookieJar) Expire(name, domain string, expires time.Time) int {
+	domain = canonicalDomain(domain)
+	return j.changed(j.session.cookieStore().expire(func(c *Cookie) bool {
+		return c.Name == name && c.Domain == domain
+	}, expires))
+}
+
+// 修改了n个Cookie，有修改时自动保存
+func (j *CookieJar) changed(n int) int {
+	if n > 0 {
+		j.session.autoSaveCookies()
+	}
+	return n
+}
@@ -0,0 +1,375 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/chttp/cookiejar"
+	nethttp "net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 按请求参数中的set设置响应的Set-Cookie
+func newCookieServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		for _, value := range r.URL.Query()["set"] {
+			w.Header().Add("Set-Cookie", value)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setCookies(t *testing.T, session *Session, server *httptest.Server, path string, values ...string) {
+	query := url2.Values{"set": values}
+	if _, err := session.Get(server.URL+path+"?"+query.Encode(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cookieNames(cookies []*Cookie) []string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name+"@"+c.Domain+c.Path)
+	}
+	return names
+}
+
+// 记录的Cookie与Jar实际保存的一致
+func TestCookieStoreRecordsResponseCookies(t *testing.T) {
+	server := newCookieServer(t)
+	session := NewSession()
+	setCookies(t, session, server, "/a/b",
+		"host=1",
+		"rooted=1; Path=/",
+		"secure=1; Path=/; Secure; HttpOnly; SameSite=None",
+		"max=1; Path=/; Max-Age=3600",
+		"foreign=1; Path=/; Domain=example.com",
+		"gone=1; Path=/; Max-Age=0",
+	)
+	cookies := session.CookieJar().All()
+	got, _ := json.Marshal(cookieNames(cookies))
+	if want := `["rooted@127.0.0.1/","secure@127.0.0.1/","max@127.0.0.1/","host@127.0.0.1/a"]`; string(got) != want {
+		t.Fatalf("cookies = %s, want %s", got, want)
+	}
+	for _, c := range cookies {
+		switch c.Name {
+		case "host":
+			if !c.HostOnly || !c.Expires.IsZero() {
+				t.Errorf("host cookie = %+v", c)
+			}
+		case "secure":
+			if !c.Secure || !c.HttpOnly || c.SameSite != "None" {
+				t.Errorf("secure cookie = %+v", c)
+			}
+		case "max":
+			if d := time.Until(c.Expires); d < 59*time.Minute || d > time.Hour {
+				t.Errorf("max cookie expires in %s", d)
+			}
+		}
+	}
+
+	// 服务器删除Cookie后不再记录
+	setCookies(t, session, server, "/", "rooted=; Path=/; Max-Age=-1")
+	if c := session.CookieJar().Get("rooted", "127.0.0.1"); c != nil {
+		t.Fatalf("deleted cookie is still recorded: %+v", c)
+	}
+}
+
+// 删除与修改过期时间同时作用于Jar
+func TestCookieJarModifiesJar(t *testing.T) {
+	server := newCookieServer(t)
+	session := NewSession()
+	setCookies(t, session, server, "/", "a=1; Path=/", "b=2; Path=/", "c=3; Path=/")
+	u, _ := url2.Parse(server.URL)
+	jarNames := func() map[string]bool {
+		names := map[string]bool{}
+		for _, c := range session.Cookies.Cookies(u) {
+			names[c.Name] = true
+		}
+		return names
+	}
+	jar := session.CookieJar()
+	if n := jar.Delete("a", "127.0.0.1"); n != 1 {
+		t.Fatalf("Delete removed %d cookies, want 1", n)
+	}
+	if jarNames()["a"] {
+		t.Fatal("deleted cookie is still sent")
+	}
+	if n := jar.Expire("b", "127.0.0.1", time.Now().Add(-time.Second)); n != 1 || jarNames()["b"] {
+		t.Fatalf("Expire in the past: n = %d, cookies = %v", n, jarNames())
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	if n := jar.Expire("c", "127.0.0.1", expires); n != 1 || !jarNames()["c"] {
+		t.Fatalf("Expire: n = %d, cookies = %v", n, jarNames())
+	}
+	if c := jar.Get("c", "127.0.0.1"); c == nil || !c.Expires.Equal(expires) || c.Value != "3" {
+		t.Fatalf("expired cookie = %+v", c)
+	}
+	if n := jar.Clear(""); n != 1 || len(jarNames()) != 0 {
+		t.Fatalf("Clear: n = %d, cookies = %v", n, jarNames())
+	}
+}
+
+// 导出后导入到新的Session得到相同的Cookie，替换Session.Cookies后不再使用之前的记录
+func TestCookieExportImport(t *testing.T) {
+	session := NewSession()
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	for _, c := range []*http.Cookie{
+		{Name: "a", Value: "1", Domain: "example.com", Path: "/", SameSite: http.SameSiteNoneMode, Secure: true},
+		{Name: "b", Value: "2", Domain: "sub.example.com", Path: "/x", Expires: expires, HttpOnly: true},
+	} {
+		if err := session.CookieJar().Set(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := session.ExportCookies(&buf, CookieJSON); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewSession()
+	if err := restored.ImportCookies(bytes.NewReader(buf.Bytes()), CookieJSON); err != nil {
+		t.Fatal(err)
+	}
+	a := session.CookieJar().All()
+	b := restored.CookieJar().All()
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) != string(jb) || len(a) != 2 {
+		t.Fatalf("imported cookies = %s, want %s", jb, ja)
+	}
+
+	restored.Cookies, _ = cookiejar.New(nil)
+	if cookies := restored.CookieJar().All(); len(cookies) != 0 {
+		t.Fatalf("replaced jar still lists %d cookies", len(cookies))
+	}
+}
+
+// 自动保存合并连续的写入，FlushCookies立即保存并返回保存的错误
+func TestPersistCookiesDebounce(t *testing.T) {
+	server := newCookieServer(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cookies.json")
+	session := NewSession()
+	if err := session.PersistCookies(path, CookieJSON); err != nil {
+		t.Fatal(err)
+	}
+	read := func() []*Cookie {
+		var cookies []*Cookie
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(data, &cookies); err != nil {
+			t.Fatal(err)
+		}
+		return cookies
+	}
+	setCookies(t, session, server, "/", "a=1; Path=/")
+	setCookies(t, session, server, "/", "b=2; Path=/")
+	if cookies := read(); len(cookies) != 0 {
+		t.Fatalf("cookies saved before the debounce delay: %d", len(cookies))
+	}
+	if err := session.FlushCookies(); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := read(); len(cookies) != 2 {
+		t.Fatalf("saved %d cookies, want 2", len(cookies))
+	}
+
+	// 定时保存
+	setCookies(t, session, server, "/", "c=3; Path=/")
+	time.Sleep(cookieSaveDelay + 500*time.Millisecond)
+	if cookies := read(); len(cookies) != 3 {
+		t.Fatalf("saved %d cookies after the debounce delay, want 3", len(cookies))
+	}
+
+	// 保存失败时由FlushCookies与Close返回错误
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	setCookies(t, session, server, "/", "d=4; Path=/")
+	if err := session.Close(); err == nil {
+		t.Fatal("Close did not report the failed save")
+	}
+	if err := session.FlushCookies(); err == nil {
+		t.Fatal("FlushCookies did not keep the last error")
+	}
+}
+
+// 同名Cookie存在多个路径时Get返回路径最短的
+func TestCookieJarGetShortestPath(t *testing.T) {
+	session := NewSession()
+	jar := session.CookieJar()
+	for _, path := range []string{"/a/b", "/b", "/a/b/c"} {
+		if err := jar.Set(&http.Cookie{Name: "sid", Value: path, Domain: "example.com", Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c := jar.Get("sid", "example.com"); c == nil || c.Path != "/b" {
+		t.Fatalf("Get = %+v, want path /b", c)
+	}
+	if err := jar.Set(&http.Cookie{Name: "sid", Value: "root", Domain: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if c := jar.Get("sid", "example.com"); c == nil || c.Path != "/" || c.Value != "root" {
+		t.Fatalf("Get = %+v, want path /", c)
+	}
+}
+
+// 读取PersistCookies保存的文件
+func readCookieNames(t *testing.T, path string) []string {
+	var cookies []*Cookie
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &cookies); err != nil {
+		t.Fatal(err)
+	}
+	return cookieNames(cookies)
+}
+
+// 通过CookieJar设置与删除的Cookie也会保存到PersistCookies的文件
+func TestCookieJarPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	session := NewSession()
+	if err := session.PersistCookies(path, CookieJSON); err != nil {
+		t.Fatal(err)
+	}
+	jar := session.CookieJar()
+	for _, c := range []*http.Cookie{
+		{Name: "a", Value: "1", Domain: "example.com"},
+		{Name: "b", Value: "2", Domain: "example.com"},
+		{Name: "c", Value: "3", Domain: "example.org"},
+	} {
+		if err := jar.Set(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(readCookieNames(t, path))
+	if want := `["a@example.com/","b@example.com/","c@example.org/"]`; string(got) != want {
+		t.Fatalf("saved cookies = %s, want %s", got, want)
+	}
+
+	if n := jar.Delete("a", "example.com"); n != 1 {
+		t.Fatalf("Delete removed %d cookies, want 1", n)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = json.Marshal(readCookieNames(t, path))
+	if want := `["b@example.com/","c@example.org/"]`; string(got) != want {
+		t.Fatalf("saved cookies after Delete = %s, want %s", got, want)
+	}
+
+	if n := jar.Clear(""); n != 2 {
+		t.Fatalf("Clear removed %d cookies, want 2", n)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names := readCookieNames(t, path); len(names) != 0 {
+		t.Fatalf("saved cookies after Clear = %v", names)
+	}
+
+	// 重新读取文件得到相同的Cookie
+	jar.Set(&http.Cookie{Name: "d", Value: "4", Domain: "example.net", Path: "/x"})
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewSession()
+	if err := restored.LoadCookies(path, CookieJSON); err != nil {
+		t.Fatal(err)
+	}
+	if c := restored.CookieJar().Get("d", "example.net"); c == nil || c.Value != "4" || c.Path != "/x" {
+		t.Fatalf("reloaded cookie = %+v", c)
+	}
+}
+
+// Set对不合法与被Jar拒绝的Cookie返回错误
+func TestCookieJarSetErrors(t *testing.T) {
+	jar := NewSession().CookieJar()
+	for _, c := range []*http.Cookie{
+		{Name: "a", Value: "1"},
+		{Name: "a", Value: "1", Domain: "."},
+		{Name: "", Value: "1", Domain: "example.com"},
+		{Name: "a", Value: "1", Domain: "example..com"},
+	} {
+		if err := jar.Set(c); err == nil {
+			t.Errorf("Set(%+v) succeeded", c)
+		}
+	}
+	if cookies := jar.All(); len(cookies) != 0 {
+		t.Fatalf("rejected cookies were recorded: %v", cookieNames(cookies))
+	}
+	if err := jar.Set(&http.Cookie{Name: "a", Value: "1", Domain: "example.com", MaxAge: -1}); err != nil {
+		t.Fatalf("deleting a missing cookie: %v", err)
+	}
+}
+
+// 导入的Cookie在Close时保存，Clear与Expire的修改在FlushCookies时保存
+func TestPersistCookiesJarChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	session := NewSession()
+	if err := session.PersistCookies(path, CookieNetscape); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	netscape := fmt.Sprintf("# Netscape HTTP Cookie File\n"+
+		".example.com\tTRUE\t/\tFALSE\t%d\ta\t1\n"+
+		"example.com\tFALSE\t/\tTRUE\t0\tb\t2\n"+
+		"example.org\tFALSE\t/\tFALSE\t0\tc\t3\n", expires)
+	if err := session.ImportCookies(strings.NewReader(netscape), CookieNetscape); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reload := func() *CookieJar {
+		restored := NewSession()
+		if err := restored.LoadCookies(path, CookieNetscape); err != nil {
+			t.Fatal(err)
+		}
+		return restored.CookieJar()
+	}
+	jar := reload()
+	if a := jar.Get("a", "example.com"); a == nil || a.HostOnly || a.Expires.Unix() != expires {
+		t.Fatalf("imported cookie a = %+v", a)
+	}
+	if b := jar.Get("b", "example.com"); b == nil || !b.HostOnly || !b.Secure {
+		t.Fatalf("imported cookie b = %+v", b)
+	}
+
+	if n := session.CookieJar().Clear("example.org"); n != 1 {
+		t.Fatalf("Clear removed %d cookies, want 1", n)
+	}
+	if n := session.CookieJar().Expire("b", "example.com", time.Now().Add(-time.Second)); n != 1 {
+		t.Fatalf("Expire removed %d cookies, want 1", n)
+	}
+	expires = time.Now().Add(2 * time.Hour).Unix()
+	if n := session.CookieJar().Expire("a", "example.com", time.Unix(expires, 0)); n != 1 {
+		t.Fatalf("Expire changed %d cookies, want 1", n)
+	}
+	if err := session.FlushCookies(); err != nil {
+		t.Fatal(err)
+	}
+	jar = reload()
+	got, _ := json.Marshal(cookieNames(jar.All()))
+	if want := `["a@example.com/"]`; string(got) != want {
+		t.Fatalf("saved cookies = %s, want %s", got, want)
+	}
+	if a := jar.Get("a", "example.com"); a.Expires.Unix() != expires {
+		t.Fatalf("saved expiry = %s, want %s", a.Expires, time.Unix(expires, 0))
+	}
+}
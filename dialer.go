@@ -0,0 +1,381 @@
+package requests
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	utls "github.com/refraction-networking/utls"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/chttp/httptrace"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"golang.org/x/net/proxy"
+	"io"
+	"net"
+	url2 "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 拨号器，负责代理隧道与TLS握手，每个Transport独享一个
+type dialer struct {
+	proxy         *url2.URL
+	tlsConfig     *utls.Config
+	ja3           string
+	ja4           string
+	userAgent     string
+	tlsExtensions *http.TLSExtensions
+	extra         *transport.ExtraExtensions
+	proxyHeaders  *http.Header
+	forceHTTP1    bool
+	forceHTTP2    bool
+	netDialer     net.Dialer
+	stats         *connStats
+}
+
+// 在上下文中传递请求自身的上下文，chttp拨号时会去掉请求的取消信号，拨号器据此恢复
+type requestContextKey struct{}
+
+func withRequestContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, ctx)
+}
+
+// 返回在请求取消或超时后同样取消的拨号上下文，取消原因与请求相同
+func dialContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	reqCtx, ok := ctx.Value(requestContextKey{}).(context.Context)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(reqCtx, func() {
+		cancel(context.Cause(reqCtx))
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// http代理访问http地址时交给chttp转发，其余情况由dialTunnel建立隧道
+func (d *dialer) proxyFunc(req *http.Request) (*url2.URL, error) {
+	if d.proxy != nil && d.proxy.Scheme == "http" && req.URL.Scheme == "http" {
+		return d.proxy, nil
+	}
+	return nil, nil
+}
+
+// 建立明文连接
+func (d *dialer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.forceHTTP2 {
+		return nil, fmt.Errorf("ForceHTTP2 requires TLS, cannot dial %s in cleartext", addr)
+	}
+	ctx, cancel := dialContext(ctx)
+	defer cancel()
+	conn, err := traceConnect(ctx, network, addr, func(ctx context.Context) (net.Conn, error) {
+		if d.proxy == nil || d.proxy.Scheme == "http" {
+			return d.netDialer.DialContext(ctx, network, addr)
+		}
+		return d.dialTunnel(ctx, network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tracked := d.stats.track(conn, addr)
+	d.stats.register(tracked, tracked, false, false, false)
+	return tracked, nil
+}
+
+// 建立TLS连接，JA3指纹在此处应用
+func (d *dialer) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx, cancel := dialContext(ctx)
+	defer cancel()
+	conn, err := traceConnect(ctx, network, addr, func(ctx context.Context) (net.Conn, error) {
+		if d.proxy == nil {
+			return d.netDialer.DialContext(ctx, network, addr)
+		}
+		return d.dialTunnel(ctx, network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 统计底层连接，TLS连接关闭时一并关闭
+	conn = d.stats.track(conn, addr)
+	// 上下文取消时关闭连接，中断ClientHello的发送与握手
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config := d.tlsConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	tlsConn, err := d.clientHello(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err = withTimeout(ctx, url.TimeoutTLSHandshake, contextTimeouts(ctx).TLSHandshake, tlsConn.HandshakeContext)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, err
+	}
+	if !stop() {
+		return nil, context.Cause(ctx)
+	}
+	if d.forceHTTP2 {
+		if protocol := tlsConn.ConnectionState().NegotiatedProtocol; protocol != "h2" {
+			tlsConn.Close()
+			return nil, fmt.Errorf("ForceHTTP2: server %s negotiated %q instead of h2", addr, protocol)
+		}
+	}
+	state := tlsConn.ConnectionState()
+	d.stats.register(conn.(*trackedConn), tlsConn, true, state.DidResume, state.NegotiatedProtocol == "h2")
+	return tlsConn, nil
+}
+
+// 构建ClientHello
+func (d *dialer) clientHello(conn net.Conn, config *utls.Config) (*utls.UConn, error) {
+	if d.ja3 == "" && d.ja4 == "" {
+		return utls.UClient(conn, config, utls.HelloGolang), nil
+	}
+	tlsConn := utls.UClient(conn, config, utls.HelloCustom)
+	var spec *utls.ClientHelloSpec
+	var err error
+	if d.ja4 != "" {
+		spec, err = transport.NewClientHelloSpecFromJA4(d.ja4, d.userAgent, d.tlsExtensions, d.extra)
+	} else {
+		spec, err = transport.NewClientHelloSpec(d.ja3, d.userAgent, d.tlsExtensions, d.extra)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.forceHTTP1 {
+		transport.StripALPNProtocol(spec, "h2")
+	}
+	if err = tlsConn.ApplyPreset(spec); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// 通过代理建立到目标地址的隧道，隧道建立后的TLS握手与直连相同，指纹不受代理影响
+func (d *dialer) dialTunnel(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch d.proxy.Scheme {
+	case "http", "https":
+		return d.dialConnect(ctx, network, addr)
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u := d.proxy.User; u != nil {
+			auth = &proxy.Auth{User: u.Username()}
+			auth.Password, _ = u.Password()
+		}
+		// socks5在本地解析域名，socks5h交给代理服务器解析
+		if d.proxy.Scheme == "socks5" {
+			var err error
+			if addr, err = resolveAddr(ctx, addr); err != nil {
+				return nil, err
+			}
+		}
+		socks, err := proxy.SOCKS5(network, proxyAddr(d.proxy), auth, &d.netDialer)
+		if err != nil {
+			return nil, err
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	case "socks4", "socks4a":
+		return d.dialSOCKS4(ctx, network, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme: %s", d.proxy.Scheme)
+}
+
+// 通过CONNECT方法建立隧道
+func (d *dialer) dialConnect(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.netDialer.DialContext(ctx, network, proxyAddr(d.proxy))
+	if err != nil {
+		return nil, err
+	}
+	if d.proxy.Scheme == "https" {
+		// 与代理之间的TLS不使用JA3指纹，也不协商ALPN
+		tlsConn := utls.UClient(conn, &utls.Config{
+			ServerName:         d.proxy.Hostname(),
+			InsecureSkipVerify: d.tlsConfig.InsecureSkipVerify,
+		}, utls.HelloGolang)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// 上下文取消时中断CONNECT的读写
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	// 请求头按ProxyHeaders中的Header-Order:顺序发送，未设置顺序时按字母顺序
+	header := http.Header{"Host": {addr}}
+	if d.proxyHeaders != nil {
+		for key, values := range *d.proxyHeaders {
+			if key == http.PHeaderOrderKey || key == http.UnChangedHeaderKey {
+				continue
+			}
+			header[key] = values
+		}
+	}
+	if u := d.proxy.User; u != nil && header.Get("Proxy-Authorization") == "" {
+		password, _ := u.Password()
+		header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url2.URL{Opaque: addr},
+		Host:   addr,
+		Header: header,
+	}
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s HTTP/1.1\r\n", addr)
+	header.Write(w)
+	w.WriteString("\r\n")
+	if err = w.Flush(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New("proxy CONNECT failed: " + resp.Status)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	return conn, nil
+}
+
+// 通过SOCKS4代理建立隧道，socks4在本地解析域名，socks4a交给代理服务器解析
+func (d *dialer) dialSOCKS4(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in address %s", addr)
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil && d.proxy.Scheme == "socks4" {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0].To4()
+	}
+
+	conn, err := d.netDialer.DialContext(ctx, network, proxyAddr(d.proxy))
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	req := []byte{4, 1, byte(port >> 8), byte(port)}
+	if ip != nil {
+		req = append(req, ip...)
+	} else {
+		// socks4a：IP为0.0.0.x，域名放在用户名之后
+		req = append(req, 0, 0, 0, 1)
+	}
+	if u := d.proxy.User; u != nil {
+		req = append(req, u.Username()...)
+	}
+	req = append(req, 0)
+	if ip == nil {
+		req = append(req, host...)
+		req = append(req, 0)
+	}
+	if _, err = conn.Write(req); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	resp := make([]byte, 8)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if resp[1] != 90 {
+		conn.Close()
+		return nil, fmt.Errorf("socks4 connect failed: code %d", resp[1])
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	return conn, nil
+}
+
+// 在本地解析地址中的域名
+func resolveAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].IP.String(), port), nil
+}
+
+// 获取代理地址，缺省端口按协议补全
+func proxyAddr(u *url2.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	case "socks5", "socks5h", "socks4", "socks4a":
+		return net.JoinHostPort(u.Hostname(), "1080")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
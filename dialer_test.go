@@ -0,0 +1,54 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 启动只接受连接、不完成握手的服务器，返回地址与已关闭连接的通知
+func newStalledServer(t *testing.T) (string, <-chan struct{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed := make(chan struct{}, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+		closed <- struct{}{}
+	}()
+	return ln.Addr().String(), closed
+}
+
+// 取消请求的上下文时中断进行中的TLS握手并关闭连接，而不是在后台继续握手
+func TestCancelAbortsHandshake(t *testing.T) {
+	for _, ja3 := range []string{"", testJA3} {
+		addr, closed := newStalledServer(t)
+		session := NewSession()
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		req := url.NewRequest()
+		req.Ja3 = ja3
+		req.Timeouts = &url.Timeouts{TLSHandshake: time.Minute}
+		_, err := session.RequestWithContext(ctx, "GET", "https://"+addr, req)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("ja3=%q: err = %v, want context.Canceled", ja3, err)
+		}
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("ja3=%q: connection still open after cancel", ja3)
+		}
+		session.Close()
+	}
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -153,8 +155,16 @@ func main() {
 			},
 		},
 	}
-	tes := transport.ToTLSExtensions(es)
-	h2ss := transport.ToHTTP2Settings(h2s)
+	tes, err := transport.ToTLSExtensions(es)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	h2ss, err := transport.ToHTTP2Settings(h2s)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	options := &transport.Options{
 		Browser:       browser,
 		Timeout:       30,
@@ -0,0 +1,28 @@
+//go:build ignore
+
+package main
+
+import (
+	"fmt"
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/fingerprint/echoserver"
+	"github.com/wangluozhe/requests/url"
+)
+
+func main() {
+	server, err := echoserver.New()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer server.Close()
+	session := requests.NewSession()
+	session.ApplyProfile("chrome_133")
+	session.TLSConfig = &url.TLSConfig{RootCAs: server.CertificatePEM}
+	r, err := session.Get(server.URL+"/api/all", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("text:", r.Text)
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -113,7 +115,11 @@ func main() {
 			},
 		},
 	}
-	h2ss := transport.ToHTTP2Settings(h2s)
+	h2ss, err := transport.ToHTTP2Settings(h2s)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	req.HTTP2Settings = h2ss
 	r, err := requests.Get("https://tls.peet.ws/api/all", req)
 	if err != nil {
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -76,7 +78,11 @@ func main() {
 			"X25519",
 		},
 	}
-	tes := transport.ToTLSExtensions(es)
+	tes, err := transport.ToTLSExtensions(es)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	req.TLSExtensions = tes
 	r, err := session.Get("https://tls.peet.ws/api/all", req)
 	if err != nil {
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -81,7 +83,11 @@ func main() {
 			"P256",
 		},
 	}
-	tes := transport.ToTLSExtensions(es)
+	tes, err := transport.ToTLSExtensions(es)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	req.TLSExtensions = tes
 	r, err := requests.Get("https://tls.peet.ws/api/all", req)
 	if err != nil {
@@ -0,0 +1,361 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 解析后的ClientHello
+type ClientHello struct {
+	Raw                 []byte // 握手消息，不含TLS记录头
+	Version             uint16 // ClientHello中的版本号
+	Random              []byte
+	SessionID           []byte
+	CipherSuites        []uint16 // 包含GREASE
+	Extensions          []uint16 // 按发送顺序，包含GREASE
+	ServerName          string
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	ALPN                []string
+	SupportedVersions   []uint16
+}
+
+// 是否为GREASE值
+func IsGREASE(v uint16) bool {
+	return (v>>8) == v&0xff && v&0xf == 0xa
+}
+
+// 解析ClientHello，data可以带TLS记录头
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	// 去掉TLS记录头
+	if len(data) >= 5 && data[0] == 0x16 && data[1] == 0x03 {
+		data = data[5:]
+	}
+	if len(data) < 4 || data[0] != 0x01 {
+		return nil, errors.New("not a ClientHello message")
+	}
+	length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if len(data) < 4+length {
+		return nil, errors.New("ClientHello message is truncated")
+	}
+	ch := &ClientHello{Raw: data[:4+length]}
+	r := reader(data[4 : 4+length])
+
+	var random, sessionID, ciphers, compression, extensions reader
+	if !r.uint16(&ch.Version) || !r.bytes(32, &random) || !r.vector8(&sessionID) || !r.vector16(&ciphers) || !r.vector8(&compression) {
+		return nil, errors.New("malformed ClientHello")
+	}
+	ch.Random, ch.SessionID = random, sessionID
+	for !ciphers.empty() {
+		var cipher uint16
+		if !ciphers.uint16(&cipher) {
+			return nil, errors.New("malformed cipher suites")
+		}
+		ch.CipherSuites = append(ch.CipherSuites, cipher)
+	}
+	if r.empty() {
+		return ch, nil
+	}
+	if !r.vector16(&extensions) {
+		return nil, errors.New("malformed extensions")
+	}
+	for !extensions.empty() {
+		var typ uint16
+		var ext reader
+		if !extensions.uint16(&typ) || !extensions.vector16(&ext) {
+			return nil, errors.New("malformed extensions")
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if err := ch.parseExtension(typ, ext); err != nil {
+			return nil, fmt.Errorf("malformed extension %d: %w", typ, err)
+		}
+	}
+	return ch, nil
+}
+
+// 解析指纹计算需要的扩展
+func (ch *ClientHello) parseExtension(typ uint16, ext reader) error {
+	malformed := errors.New("unexpected length")
+	switch typ {
+	case 0: // server_name
+		var list reader
+		if !ext.vector16(&list) {
+			return malformed
+		}
+		for !list.empty() {
+			var nameType uint8
+			var name reader
+			if !list.uint8(&nameType) || !list.vector16(&name) {
+				return malformed
+			}
+			if nameType == 0 {
+				ch.ServerName = string(name)
+			}
+		}
+	case 10: // supported_groups
+		var list reader
+		if !ext.vector16(&list) {
+			return malformed
+		}
+		for !list.empty() {
+			var group uint16
+			if !list.uint16(&group) {
+				return malformed
+			}
+			ch.SupportedGroups = append(ch.SupportedGroups, group)
+		}
+	case 11: // ec_point_formats
+		var list reader
+		if !ext.vector8(&list) {
+			return malformed
+		}
+		ch.PointFormats = append([]uint8{}, list...)
+	case 13: // signature_algorithms
+		var list reader
+		if !ext.vector16(&list) {
+			return malformed
+		}
+		for !list.empty() {
+			var algorithm uint16
+			if !list.uint16(&algorithm) {
+				return malformed
+			}
+			ch.SignatureAlgorithms = append(ch.SignatureAlgorithms, algorithm)
+		}
+	case 16: // application_layer_protocol_negotiation
+		var list reader
+		if !ext.vector16(&list) {
+			return malformed
+		}
+		for !list.empty() {
+			var protocol reader
+			if !list.vector8(&protocol) {
+				return malformed
+			}
+			ch.ALPN = append(ch.ALPN, string(protocol))
+		}
+	case 43: // supported_versions
+		var list reader
+		if !ext.vector8(&list) {
+			return malformed
+		}
+		for !list.empty() {
+			var version uint16
+			if !list.uint16(&version) {
+				return malformed
+			}
+			ch.SupportedVersions = append(ch.SupportedVersions, version)
+		}
+	}
+	return nil
+}
+
+// JA3字符串
+func (ch *ClientHello) JA3() string {
+	return ch.ja3(ch.Extensions)
+}
+
+// JA3N字符串，扩展按数值排序，不受Chrome扩展随机排列影响
+func (ch *ClientHello) JA3N() string {
+	extensions := append([]uint16(nil), ch.Extensions...)
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+	return ch.ja3(extensions)
+}
+
+func (ch *ClientHello) ja3(extensions []uint16) string {
+	pointFormats := make([]string, len(ch.PointFormats))
+	for i, format := range ch.PointFormats {
+		pointFormats[i] = strconv.Itoa(int(format))
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.Version)),
+		joinDecimal(ch.CipherSuites),
+		joinDecimal(extensions),
+		joinDecimal(ch.SupportedGroups),
+		strings.Join(pointFormats, "-"),
+	}, ",")
+}
+
+// JA4字符串
+func (ch *ClientHello) JA4() string {
+	ciphers, extensions := ch.ja4Lists()
+	sort.Strings(ciphers)
+	sort.Strings(extensions)
+	return ch.ja4Prefix() + "_" + hash12(strings.Join(ciphers, ",")) + "_" + hash12(ch.ja4Extensions(extensions))
+}
+
+// JA4_r字符串，密码套件与扩展按数值排序，不做哈希
+func (ch *ClientHello) JA4R() string {
+	ciphers, extensions := ch.ja4Lists()
+	sort.Strings(ciphers)
+	sort.Strings(extensions)
+	return ch.ja4Prefix() + "_" + strings.Join(ciphers, ",") + "_" + ch.ja4Extensions(extensions)
+}
+
+// JA4_ro字符串，密码套件与扩展保持发送顺序，扩展包含SNI与ALPN
+func (ch *ClientHello) JA4RO() string {
+	ciphers := hexList(ch.CipherSuites)
+	extensions := hexList(ch.Extensions)
+	return ch.ja4Prefix() + "_" + strings.Join(ciphers, ",") + "_" + ch.ja4Extensions(extensions)
+}
+
+// JA4的a部分，如t13d1516h2
+func (ch *ClientHello) ja4Prefix() string {
+	version := ch.Version
+	for _, v := range ch.SupportedVersions {
+		if !IsGREASE(v) && v > version {
+			version = v
+		}
+	}
+	versions := map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3"}
+	v, ok := versions[version]
+	if !ok {
+		v = "00"
+	}
+	sni := "i"
+	for _, extension := range ch.Extensions {
+		if extension == 0 {
+			sni = "d"
+		}
+	}
+	ciphers, _ := ch.ja4Lists()
+	extensionCount := 0
+	for _, extension := range ch.Extensions {
+		if !IsGREASE(extension) {
+			extensionCount++
+		}
+	}
+	alpn := "00"
+	if len(ch.ALPN) > 0 && ch.ALPN[0] != "" {
+		first, last := ch.ALPN[0][0], ch.ALPN[0][len(ch.ALPN[0])-1]
+		if isAlphanumeric(first) && isAlphanumeric(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			h := hex.EncodeToString([]byte(ch.ALPN[0]))
+			alpn = string([]byte{h[0], h[len(h)-1]})
+		}
+	}
+	return fmt.Sprintf("t%s%s%02d%02d%s", v, sni, min(len(ciphers), 99), min(extensionCount, 99), alpn)
+}
+
+// 去掉GREASE后的密码套件，以及去掉GREASE、SNI、ALPN后的扩展
+func (ch *ClientHello) ja4Lists() (ciphers, extensions []string) {
+	ciphers = hexList(ch.CipherSuites)
+	for _, extension := range ch.Extensions {
+		if extension != 0 && extension != 16 && !IsGREASE(extension) {
+			extensions = append(extensions, fmt.Sprintf("%04x", extension))
+		}
+	}
+	return ciphers, extensions
+}
+
+// JA4的c部分原文，扩展与签名算法用下划线连接
+func (ch *ClientHello) ja4Extensions(extensions []string) string {
+	s := strings.Join(extensions, ",")
+	if algorithms := hexList(ch.SignatureAlgorithms); len(algorithms) > 0 {
+		s += "_" + strings.Join(algorithms, ",")
+	}
+	return s
+}
+
+// MD5摘要的十六进制字符串，用于JA3哈希
+func MD5(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// SHA256摘要的前12个十六进制字符，原文为空时返回12个0
+func hash12(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// 去掉GREASE后以-连接的十进制列表
+func joinDecimal(values []uint16) string {
+	var list []string
+	for _, v := range values {
+		if !IsGREASE(v) {
+			list = append(list, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(list, "-")
+}
+
+// 去掉GREASE后的四位十六进制列表
+func hexList(values []uint16) []string {
+	var list []string
+	for _, v := range values {
+		if !IsGREASE(v) {
+			list = append(list, fmt.Sprintf("%04x", v))
+		}
+	}
+	return list
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// 按TLS编码读取数据
+type reader []byte
+
+func (r *reader) empty() bool {
+	return len(*r) == 0
+}
+
+func (r *reader) bytes(n int, v *reader) bool {
+	if len(*r) < n {
+		return false
+	}
+	*v = (*r)[:n]
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) uint8(v *uint8) bool {
+	if len(*r) < 1 {
+		return false
+	}
+	*v = (*r)[0]
+	*r = (*r)[1:]
+	return true
+}
+
+func (r *reader) uint16(v *uint16) bool {
+	if len(*r) < 2 {
+		return false
+	}
+	*v = uint16((*r)[0])<<8 | uint16((*r)[1])
+	*r = (*r)[2:]
+	return true
+}
+
+func (r *reader) vector8(v *reader) bool {
+	var n uint8
+	if !r.uint8(&n) || len(*r) < int(n) {
+		return false
+	}
+	*v = (*r)[:n]
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) vector16(v *reader) bool {
+	var n uint16
+	if !r.uint16(&n) || len(*r) < int(n) {
+		return false
+	}
+	*v = (*r)[:n]
+	*r = (*r)[n:]
+	return true
+}
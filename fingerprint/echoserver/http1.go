@@ -0,0 +1,74 @@
+package echoserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/requests/fingerprint"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 一个TLS连接
+type connection struct {
+	conn net.Conn
+	ip   string
+	tls  *TLSReport
+}
+
+// 按原始顺序与大小写读取请求头，支持keep-alive
+func (c *connection) serveHTTP1() {
+	reader := bufio.NewReader(c.conn)
+	for {
+		var head bytes.Buffer
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			head.WriteString(line)
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(io.MultiReader(&head, reader)))
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+
+		var fields []fingerprint.HeaderField
+		for _, line := range lines[1:] {
+			name, value, _ := strings.Cut(line, ":")
+			fields = append(fields, fingerprint.HeaderField{Name: name, Value: strings.TrimSpace(value)})
+		}
+		report := &Report{
+			IP:          c.ip,
+			HTTPVersion: req.Proto,
+			Method:      req.Method,
+			Path:        req.RequestURI,
+			UserAgent:   req.UserAgent(),
+			TLS:         c.tls,
+			HTTP1:       &HTTP1Report{Headers: lines[1:]},
+			JA4H:        fingerprint.JA4H(req.Method, req.Proto, fields),
+		}
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(c.conn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		if err != nil || req.Close {
+			return
+		}
+	}
+}
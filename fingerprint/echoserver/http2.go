@@ -0,0 +1,222 @@
+package echoserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/requests/fingerprint"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 客户端连接前言
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+var settingNames = map[http2.SettingID]string{
+	http2.SettingHeaderTableSize:      "HEADER_TABLE_SIZE",
+	http2.SettingEnablePush:           "ENABLE_PUSH",
+	http2.SettingMaxConcurrentStreams: "MAX_CONCURRENT_STREAMS",
+	http2.SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
+	http2.SettingMaxFrameSize:         "MAX_FRAME_SIZE",
+	http2.SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+	0x8:                               "ENABLE_CONNECT_PROTOCOL",
+	0x9:                               "NO_RFC7540_PRIORITIES",
+}
+
+// 记录客户端发送的帧，请求结束后返回报告
+type http2Connection struct {
+	*connection
+	framer     *http2.Framer
+	frames     []Frame
+	settings   []string
+	window     string
+	priorities []string
+	headers    map[uint32]*http2.MetaHeadersFrame
+}
+
+func (c *connection) serveHTTP2() {
+	preface := make([]byte, len(http2Preface))
+	if _, err := io.ReadFull(c.conn, preface); err != nil || string(preface) != http2Preface {
+		return
+	}
+	h2 := &http2Connection{
+		connection: c,
+		framer:     http2.NewFramer(c.conn, c.conn),
+		headers:    make(map[uint32]*http2.MetaHeadersFrame),
+	}
+	h2.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := h2.framer.WriteSettings(); err != nil {
+		return
+	}
+	for {
+		frame, err := h2.framer.ReadFrame()
+		if err != nil {
+			return
+		}
+		if err = h2.handle(frame); err != nil {
+			return
+		}
+	}
+}
+
+func (h2 *http2Connection) handle(frame http2.Frame) error {
+	header := frame.Header()
+	switch f := frame.(type) {
+	case *http2.SettingsFrame:
+		if f.IsAck() {
+			return nil
+		}
+		record := Frame{FrameType: "SETTINGS", Length: header.Length}
+		var settings []string
+		f.ForeachSetting(func(setting http2.Setting) error {
+			name, ok := settingNames[setting.ID]
+			if !ok {
+				name = "UNKNOWN_SETTING_" + strconv.Itoa(int(setting.ID))
+			}
+			record.Settings = append(record.Settings, fmt.Sprintf("%s = %d", name, setting.Val))
+			settings = append(settings, fmt.Sprintf("%d:%d", setting.ID, setting.Val))
+			return nil
+		})
+		// Akamai指纹只使用第一个SETTINGS帧
+		if h2.settings == nil {
+			h2.settings = settings
+		}
+		h2.frames = append(h2.frames, record)
+		return h2.framer.WriteSettingsAck()
+	case *http2.WindowUpdateFrame:
+		h2.frames = append(h2.frames, Frame{FrameType: "WINDOW_UPDATE", Length: header.Length, StreamID: header.StreamID, Increment: f.Increment})
+		if header.StreamID == 0 && h2.window == "" {
+			h2.window = strconv.Itoa(int(f.Increment))
+		}
+	case *http2.PriorityFrame:
+		record := Frame{FrameType: "PRIORITY", Length: header.Length, StreamID: header.StreamID, Priority: newPriority(f.PriorityParam)}
+		h2.frames = append(h2.frames, record)
+		h2.priorities = append(h2.priorities, fmt.Sprintf("%d:%d:%d:%d", header.StreamID, record.Priority.Exclusive, f.StreamDep, record.Priority.Weight))
+	case *http2.MetaHeadersFrame:
+		record := Frame{FrameType: "HEADERS", Length: header.Length, StreamID: header.StreamID, Flags: headersFlags(header.Flags)}
+		for _, field := range f.Fields {
+			record.Headers = append(record.Headers, field.Name+": "+field.Value)
+		}
+		if f.HasPriority() {
+			record.Priority = newPriority(f.Priority)
+		}
+		h2.frames = append(h2.frames, record)
+		h2.headers[header.StreamID] = f
+		if f.StreamEnded() {
+			return h2.respond(header.StreamID)
+		}
+	case *http2.DataFrame:
+		h2.frames = append(h2.frames, Frame{FrameType: "DATA", Length: header.Length, StreamID: header.StreamID})
+		if n := uint32(len(f.Data())); n > 0 {
+			if err := h2.framer.WriteWindowUpdate(0, n); err != nil {
+				return err
+			}
+		}
+		if f.StreamEnded() {
+			return h2.respond(header.StreamID)
+		}
+	case *http2.PingFrame:
+		if !f.IsAck() {
+			return h2.framer.WritePing(true, f.Data)
+		}
+	case *http2.GoAwayFrame:
+		return io.EOF
+	}
+	return nil
+}
+
+// 返回当前连接上已收到的全部帧
+func (h2 *http2Connection) respond(streamID uint32) error {
+	headers, ok := h2.headers[streamID]
+	if !ok {
+		return nil
+	}
+	delete(h2.headers, streamID)
+
+	var pseudo []string
+	var fields []fingerprint.HeaderField
+	for _, field := range headers.Fields {
+		if field.IsPseudo() {
+			pseudo = append(pseudo, field.Name[1:2])
+		} else {
+			fields = append(fields, fingerprint.HeaderField{Name: field.Name, Value: field.Value})
+		}
+	}
+	window, priorities := h2.window, "0"
+	if window == "" {
+		window = "00"
+	}
+	if len(h2.priorities) > 0 {
+		priorities = strings.Join(h2.priorities, ",")
+	}
+	akamai := strings.Join([]string{strings.Join(h2.settings, ";"), window, priorities, strings.Join(pseudo, ",")}, "|")
+
+	method := headers.PseudoValue("method")
+	report := &Report{
+		IP:          h2.ip,
+		HTTPVersion: "h2",
+		Method:      method,
+		Path:        headers.PseudoValue("path"),
+		TLS:         h2.tls,
+		HTTP2: &HTTP2Report{
+			AkamaiFingerprint:     akamai,
+			AkamaiFingerprintHash: fingerprint.MD5(akamai),
+			SentFrames:            append([]Frame(nil), h2.frames...),
+		},
+		JA4H: fingerprint.JA4H(method, "HTTP/2.0", fields),
+	}
+	for _, field := range fields {
+		if field.Name == "user-agent" {
+			report.UserAgent = field.Value
+		}
+	}
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	encoder.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+	encoder.WriteField(hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(body))})
+	err = h2.framer.WriteHeaders(http2.HeadersFrameParam{StreamID: streamID, BlockFragment: block.Bytes(), EndHeaders: true})
+	if err != nil {
+		return err
+	}
+	for len(body) > 16384 {
+		if err = h2.framer.WriteData(streamID, false, body[:16384]); err != nil {
+			return err
+		}
+		body = body[16384:]
+	}
+	return h2.framer.WriteData(streamID, true, body)
+}
+
+func newPriority(param http2.PriorityParam) *Priority {
+	priority := &Priority{Weight: int(param.Weight) + 1, DependsOn: param.StreamDep}
+	if param.Exclusive {
+		priority.Exclusive = 1
+	}
+	return priority
+}
+
+func headersFlags(flags http2.Flags) []string {
+	var list []string
+	if flags.Has(http2.FlagHeadersEndStream) {
+		list = append(list, "EndStream (0x1)")
+	}
+	if flags.Has(http2.FlagHeadersEndHeaders) {
+		list = append(list, "EndHeaders (0x4)")
+	}
+	if flags.Has(http2.FlagHeadersPadded) {
+		list = append(list, "Padded (0x8)")
+	}
+	if flags.Has(http2.FlagHeadersPriority) {
+		list = append(list, "Priority (0x20)")
+	}
+	return list
+}
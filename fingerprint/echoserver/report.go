@@ -0,0 +1,227 @@
+package echoserver
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"github.com/wangluozhe/requests/fingerprint"
+	"strconv"
+)
+
+// 回显报告，字段与tls.peet.ws/api/all保持一致
+type Report struct {
+	IP          string       `json:"ip"`
+	HTTPVersion string       `json:"http_version"`
+	Method      string       `json:"method"`
+	Path        string       `json:"path"`
+	UserAgent   string       `json:"user_agent"`
+	TLS         *TLSReport   `json:"tls"`
+	HTTP1       *HTTP1Report `json:"http1,omitempty"`
+	HTTP2       *HTTP2Report `json:"http2,omitempty"`
+	JA4H        string       `json:"ja4h"`
+}
+
+type TLSReport struct {
+	Ciphers              []string    `json:"ciphers"`
+	Extensions           []Extension `json:"extensions"`
+	TLSVersionRecord     string      `json:"tls_version_record"`
+	TLSVersionNegotiated string      `json:"tls_version_negotiated"`
+	JA3                  string      `json:"ja3"`
+	JA3Hash              string      `json:"ja3_hash"`
+	JA3N                 string      `json:"ja3n"`
+	JA3NHash             string      `json:"ja3n_hash"`
+	JA4                  string      `json:"ja4"`
+	JA4R                 string      `json:"ja4_r"`
+	JA4RO                string      `json:"ja4_ro"`
+	ClientRandom         string      `json:"client_random"`
+	SessionID            string      `json:"session_id"`
+	ClientHello          string      `json:"client_hello"` // 十六进制的ClientHello握手消息
+}
+
+// TLS扩展，只填充与扩展类型对应的字段
+type Extension struct {
+	Name                       string   `json:"name"`
+	ServerName                 string   `json:"server_name,omitempty"`
+	SupportedGroups            []string `json:"supported_groups,omitempty"`
+	EllipticCurvesPointFormats []string `json:"elliptic_curves_point_formats,omitempty"`
+	SignatureAlgorithms        []string `json:"signature_algorithms,omitempty"`
+	Protocols                  []string `json:"protocols,omitempty"`
+	Versions                   []string `json:"versions,omitempty"`
+}
+
+type HTTP1Report struct {
+	Headers []string `json:"headers"`
+}
+
+type HTTP2Report struct {
+	AkamaiFingerprint     string  `json:"akamai_fingerprint"`
+	AkamaiFingerprintHash string  `json:"akamai_fingerprint_hash"`
+	SentFrames            []Frame `json:"sent_frames"`
+}
+
+// 客户端发送的HTTP2帧
+type Frame struct {
+	FrameType string    `json:"frame_type"`
+	Length    uint32    `json:"length"`
+	StreamID  uint32    `json:"stream_id,omitempty"`
+	Settings  []string  `json:"settings,omitempty"`
+	Increment uint32    `json:"increment,omitempty"`
+	Headers   []string  `json:"headers,omitempty"`
+	Flags     []string  `json:"flags,omitempty"`
+	Priority  *Priority `json:"priority,omitempty"`
+}
+
+type Priority struct {
+	Weight    int    `json:"weight"`
+	DependsOn uint32 `json:"depends_on"`
+	Exclusive int    `json:"exclusive"`
+}
+
+func newTLSReport(raw []byte, recordVersion uint16, state tls.ConnectionState) (*TLSReport, error) {
+	hello, err := fingerprint.ParseClientHello(raw)
+	if err != nil {
+		return nil, err
+	}
+	report := &TLSReport{
+		TLSVersionRecord:     strconv.Itoa(int(recordVersion)),
+		TLSVersionNegotiated: strconv.Itoa(int(state.Version)),
+		JA3:                  hello.JA3(),
+		JA3N:                 hello.JA3N(),
+		JA4:                  hello.JA4(),
+		JA4R:                 hello.JA4R(),
+		JA4RO:                hello.JA4RO(),
+		ClientRandom:         hex.EncodeToString(hello.Random),
+		SessionID:            hex.EncodeToString(hello.SessionID),
+		ClientHello:          hex.EncodeToString(hello.Raw),
+	}
+	report.JA3Hash = fingerprint.MD5(report.JA3)
+	report.JA3NHash = fingerprint.MD5(report.JA3N)
+	for _, cipher := range hello.CipherSuites {
+		if fingerprint.IsGREASE(cipher) {
+			report.Ciphers = append(report.Ciphers, fmt.Sprintf("TLS_GREASE (0x%04X)", cipher))
+		} else {
+			report.Ciphers = append(report.Ciphers, tls.CipherSuiteName(cipher))
+		}
+	}
+	for _, typ := range hello.Extensions {
+		report.Extensions = append(report.Extensions, newExtension(hello, typ))
+	}
+	return report, nil
+}
+
+func newExtension(hello *fingerprint.ClientHello, typ uint16) Extension {
+	if fingerprint.IsGREASE(typ) {
+		return Extension{Name: fmt.Sprintf("TLS_GREASE (0x%04x)", typ)}
+	}
+	name, ok := extensionNames[typ]
+	if !ok {
+		name = "unknown"
+	}
+	extension := Extension{Name: fmt.Sprintf("%s (%d)", name, typ)}
+	switch typ {
+	case 0:
+		extension.ServerName = hello.ServerName
+	case 10:
+		extension.SupportedGroups = names(hello.SupportedGroups, groupNames)
+	case 11:
+		for _, format := range hello.PointFormats {
+			extension.EllipticCurvesPointFormats = append(extension.EllipticCurvesPointFormats, fmt.Sprintf("0x%02x", format))
+		}
+	case 13:
+		extension.SignatureAlgorithms = names(hello.SignatureAlgorithms, signatureAlgorithmNames)
+	case 16:
+		extension.Protocols = hello.ALPN
+	case 43:
+		extension.Versions = names(hello.SupportedVersions, versionNames)
+	}
+	return extension
+}
+
+// 按名称表转换，未知值保留数值
+func names(values []uint16, table map[uint16]string) []string {
+	var list []string
+	for _, v := range values {
+		switch name, ok := table[v]; {
+		case fingerprint.IsGREASE(v):
+			list = append(list, "GREASE")
+		case ok:
+			list = append(list, fmt.Sprintf("%s (%d)", name, v))
+		default:
+			list = append(list, fmt.Sprintf("0x%04x", v))
+		}
+	}
+	return list
+}
+
+var extensionNames = map[uint16]string{
+	0:     "server_name",
+	5:     "status_request",
+	10:    "supported_groups",
+	11:    "ec_point_formats",
+	13:    "signature_algorithms",
+	16:    "application_layer_protocol_negotiation",
+	17:    "status_request_v2",
+	18:    "signed_certificate_timestamp",
+	21:    "padding",
+	22:    "encrypt_then_mac",
+	23:    "extended_master_secret",
+	27:    "compress_certificate",
+	28:    "record_size_limit",
+	34:    "delegated_credentials",
+	35:    "session_ticket",
+	41:    "pre_shared_key",
+	42:    "early_data",
+	43:    "supported_versions",
+	44:    "cookie",
+	45:    "psk_key_exchange_modes",
+	49:    "post_handshake_auth",
+	50:    "signature_algorithms_cert",
+	51:    "key_share",
+	57:    "quic_transport_parameters",
+	17513: "application_settings",
+	17613: "application_settings_new",
+	30032: "channel_id",
+	65037: "encrypted_client_hello",
+	65281: "extensionRenegotiationInfo",
+}
+
+var groupNames = map[uint16]string{
+	23:    "P-256",
+	24:    "P-384",
+	25:    "P-521",
+	29:    "X25519",
+	30:    "X448",
+	256:   "ffdhe2048",
+	257:   "ffdhe3072",
+	258:   "ffdhe4096",
+	259:   "ffdhe6144",
+	260:   "ffdhe8192",
+	4588:  "X25519MLKEM768",
+	25497: "X25519Kyber768",
+}
+
+var signatureAlgorithmNames = map[uint16]string{
+	0x0201: "rsa_pkcs1_sha1",
+	0x0203: "ecdsa_sha1",
+	0x0401: "rsa_pkcs1_sha256",
+	0x0403: "ecdsa_secp256r1_sha256",
+	0x0501: "rsa_pkcs1_sha384",
+	0x0503: "ecdsa_secp384r1_sha384",
+	0x0601: "rsa_pkcs1_sha512",
+	0x0603: "ecdsa_secp521r1_sha512",
+	0x0804: "rsa_pss_rsae_sha256",
+	0x0805: "rsa_pss_rsae_sha384",
+	0x0806: "rsa_pss_rsae_sha512",
+	0x0807: "ed25519",
+	0x0808: "ed448",
+	0x0809: "rsa_pss_pss_sha256",
+	0x080a: "rsa_pss_pss_sha384",
+	0x080b: "rsa_pss_pss_sha512",
+}
+
+var versionNames = map[uint16]string{
+	0x0304: "TLS 1.3",
+	0x0303: "TLS 1.2",
+	0x0302: "TLS 1.1",
+	0x0301: "TLS 1.0",
+}
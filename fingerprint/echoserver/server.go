@@ -0,0 +1,199 @@
+package echoserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 本地指纹回显服务器，对每个请求返回与tls.peet.ws/api/all格式兼容的JSON报告
+type Server struct {
+	URL            string // https://localhost:端口
+	Addr           string // 监听地址
+	CertificatePEM []byte // 自签名证书，可设置到url.TLSConfig.RootCAs
+
+	listener net.Listener
+	config   *tls.Config
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// 在127.0.0.1的随机端口上启动服务器
+func New() (*Server, error) {
+	return Listen("127.0.0.1:0")
+}
+
+// 在指定地址上启动服务器
+func Listen(addr string) (*Server, error) {
+	certificate, certificatePEM, err := newCertificate()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:           listener.Addr().String(),
+		CertificatePEM: certificatePEM,
+		listener:       listener,
+		config: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			NextProtos:   []string{"h2", "http/1.1"},
+			MinVersion:   tls.VersionTLS10,
+		},
+		conns: make(map[net.Conn]struct{}),
+	}
+	s.URL = "https://localhost:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// 关闭服务器及所有连接
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mutex.Lock()
+				delete(s.conns, conn)
+				s.mutex.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+// 先读取原始ClientHello，再交给crypto/tls完成握手
+func (s *Server) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	records, hello, recordVersion, err := readClientHello(conn)
+	if err != nil {
+		return
+	}
+	tlsConn := tls.Server(&replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(records), conn)}, s.config)
+	if err = tlsConn.Handshake(); err != nil {
+		return
+	}
+	tlsReport, err := newTLSReport(hello, recordVersion, tlsConn.ConnectionState())
+	if err != nil {
+		return
+	}
+	c := &connection{conn: tlsConn, ip: conn.RemoteAddr().String(), tls: tlsReport}
+	if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+		c.serveHTTP2()
+	} else {
+		c.serveHTTP1()
+	}
+}
+
+// 读取包含完整ClientHello的TLS记录，返回原始记录、握手消息及记录层版本
+func readClientHello(conn net.Conn) (records, hello []byte, recordVersion uint16, err error) {
+	header := make([]byte, 5)
+	for {
+		if _, err = io.ReadFull(conn, header); err != nil {
+			return nil, nil, 0, err
+		}
+		if header[0] != 0x16 {
+			return nil, nil, 0, errors.New("not a TLS handshake record")
+		}
+		if recordVersion == 0 {
+			recordVersion = uint16(header[1])<<8 | uint16(header[2])
+		}
+		fragment := make([]byte, int(header[3])<<8|int(header[4]))
+		if _, err = io.ReadFull(conn, fragment); err != nil {
+			return nil, nil, 0, err
+		}
+		records = append(append(records, header...), fragment...)
+		hello = append(hello, fragment...)
+		if len(hello) >= 4 && len(hello) >= 4+(int(hello[1])<<16|int(hello[2])<<8|int(hello[3])) {
+			return records, hello, recordVersion, nil
+		}
+	}
+}
+
+// 重新读取已消费的ClientHello记录
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// 生成localhost与127.0.0.1可用的自签名证书
+func newCertificate() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "requests fingerprint echo server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
@@ -0,0 +1,164 @@
+package echoserver
+
+import (
+	"encoding/json"
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/profiles"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	testJA3    = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0"
+	testJA4    = "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,fe0d,ff01_0403,0804,0401,0503,0805,0501,0806,0601"
+	testAkamai = "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+)
+
+func newServer(t *testing.T) *Server {
+	server, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// 发送请求并解析回显报告
+func echo(t *testing.T, server *Server, session *requests.Session, req *url.Request) *Report {
+	session.TLSConfig = &url.TLSConfig{RootCAs: server.CertificatePEM}
+	r, err := session.Get(server.URL+"/api/all", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &Report{}
+	if err = json.Unmarshal(r.Content, report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// 固定请求的参考指纹，哈希由独立的工具计算（JA3与Akamai为md5，JA4与JA4H为sha256的前12位），
+// 其中JA4与tls.peet.ws等公开数据中Chrome的JA4 t13d1516h2_8daaf6152771_02713d6af862相同
+type reference struct {
+	httpVersion string
+	ja3         string
+	ja3Hash     string
+	ja4         string
+	ja4r        string
+	ja4h        string
+	akamai      string
+	akamaiHash  string
+}
+
+func referenceRequest() *url.Request {
+	req := url.NewRequest()
+	req.Headers = url.NewHeaders()
+	req.Headers.Set("User-Agent", "test")
+	req.Headers.Set("Accept-Language", "en-US,en;q=0.9")
+	req.Headers.Set("Cookie", "b=2; a=1")
+	req.Headers.Set("Referer", "https://example.com/")
+	return req
+}
+
+// 服务器收到的指纹与参考值一致
+func TestReportReferenceValues(t *testing.T) {
+	server := newServer(t)
+	tests := []struct {
+		name    string
+		session func(*requests.Session)
+		req     func(*url.Request) error
+		want    reference
+	}{
+		{
+			name:    "ja3 ForceHTTP1",
+			session: func(s *requests.Session) { s.Ja3 = testJA3 },
+			req:     func(r *url.Request) error { r.ForceHTTP1 = true; return nil },
+			want: reference{
+				httpVersion: "HTTP/1.1",
+				ja3:         testJA3,
+				ja3Hash:     "e1d8b04eeb8ef3954ec4f49267a783ef",
+				ja4:         "t13d1515h1_8daaf6152771_4d8a99c1bc01",
+				ja4r:        "t13d1515h1_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0503,0603,0804,0805,0806,0401,0501,0601,0203,0201",
+				// Accept,Accept-Encoding,Accept-Language,Connection,Host,User-Agent，Cookie为a,b与a=1,b=2
+				ja4h: "ge11cr06enus_73e49fadadc7_1eb7c54d5283_06beefe2b477",
+			},
+		},
+		{
+			name:    "ja4 h2",
+			session: func(s *requests.Session) { s.Ja4 = testJA4 },
+			req: func(r *url.Request) error {
+				h2Settings, err := transport.ParseAkamaiFingerprint(testAkamai)
+				if err != nil {
+					return err
+				}
+				r.HTTP2Settings, err = transport.ToHTTP2Settings(h2Settings)
+				return err
+			},
+			want: reference{
+				httpVersion: "h2",
+				ja3:         "771,47-53-156-157-4865-4866-4867-49171-49172-49195-49196-49199-49200-52392-52393,0-16-5-10-11-13-18-23-27-35-43-45-51-17513-65037-65281,29-23-24,0",
+				ja3Hash:     "c3cb1bd6e410c252f07678bae53f039f",
+				ja4:         "t13d1516h2_8daaf6152771_02713d6af862",
+				ja4r:        testJA4,
+				// accept,accept-encoding,accept-language,user-agent
+				ja4h:       "ge20cr04enus_b74aa5121121_1eb7c54d5283_06beefe2b477",
+				akamai:     testAkamai,
+				akamaiHash: "52d84b11737d980aef856699f885ca86",
+			},
+		},
+	}
+	for _, test := range tests {
+		session := requests.NewSession()
+		test.session(session)
+		req := referenceRequest()
+		if err := test.req(req); err != nil {
+			t.Fatal(err)
+		}
+		report := echo(t, server, session, req)
+		got := reference{httpVersion: report.HTTPVersion, ja3: report.TLS.JA3, ja3Hash: report.TLS.JA3Hash, ja4: report.TLS.JA4, ja4r: report.TLS.JA4R, ja4h: report.JA4H}
+		if report.HTTP2 != nil {
+			got.akamai, got.akamaiHash = report.HTTP2.AkamaiFingerprint, report.HTTP2.AkamaiFingerprintHash
+		}
+		if got != test.want {
+			t.Errorf("%s: report = %+v, want %+v", test.name, got, test.want)
+		}
+		session.Close()
+	}
+}
+
+// 服务器收到的ClientHello与每个内置模板声明的JA3一致，开启随机扩展顺序时比较排序后的扩展
+func TestReportProfiles(t *testing.T) {
+	server := newServer(t)
+	for _, name := range profiles.Names() {
+		p, err := profiles.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session := requests.NewSession()
+		if err = session.ApplyProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		report := echo(t, server, session, url.NewRequest())
+		if want := sortExtensions(p.JA3); report.TLS.JA3N != want {
+			t.Errorf("%s: JA3N = %s, want %s", name, report.TLS.JA3N, want)
+		}
+		session.Close()
+	}
+}
+
+// 将JA3中的扩展按数值排序
+func sortExtensions(ja3 string) string {
+	fields := strings.Split(ja3, ",")
+	extensions := strings.Split(fields[2], "-")
+	sort.Slice(extensions, func(i, j int) bool {
+		a, _ := strconv.Atoi(extensions[i])
+		b, _ := strconv.Atoi(extensions[j])
+		return a < b
+	})
+	fields[2] = strings.Join(extensions, "-")
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,219 @@
+package fingerprint
+
+import (
+	utls "github.com/refraction-networking/utls"
+	http "github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"net"
+	url2 "net/url"
+	"sort"
+	"strings"
+)
+
+// 请求的指纹信息
+type Fingerprint struct {
+	ClientHello []byte // ClientHello握手消息，明文http请求时为nil
+	JA3         string
+	JA3Hash     string
+	JA3N        string // 扩展排序后的JA3
+	JA3NHash    string
+	JA4         string
+	JA4R        string // 密码套件与扩展排序后的原文
+	JA4RO       string // 密码套件与扩展保持发送顺序的原文
+	JA4H        string
+	Akamai      string // Akamai HTTP2指纹，不使用HTTP2时为空
+	AkamaiHash  string
+	Protocol    string // 服务器支持时协商的协议，h2或http/1.1
+}
+
+// 在本地计算session发送请求时使用的指纹，不会发出网络请求，session与req可为nil。
+// 服务器选择的ALPN协议未知，Protocol与Akamai指纹按服务器支持h2计算
+func Compute(session *requests.Session, method, rawurl string, req *url.Request) (*Fingerprint, error) {
+	if session == nil {
+		session = requests.NewSession()
+	}
+	if req == nil {
+		req = url.NewRequest()
+	}
+	preq, err := session.Prepare_request(&models.Request{
+		Method:  method,
+		Url:     rawurl,
+		Params:  req.Params,
+		Headers: req.Headers,
+		Cookies: req.Cookies,
+		Data:    req.Data,
+		Files:   req.Files,
+		Json:    req.Json,
+		Body:    req.Body,
+		Auth:    req.Auth,
+	})
+	if err != nil {
+		return nil, err
+	}
+	requests.MergeHeaderOrder(preq, req)
+	u, err := url2.Parse(preq.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := session.FingerprintSettings(preq, req)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &Fingerprint{Protocol: "http/1.1"}
+	if u.Scheme == "https" {
+		fp.ClientHello, err = clientHello(u.Hostname(), settings)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := ParseClientHello(fp.ClientHello)
+		if err != nil {
+			return nil, err
+		}
+		fp.JA3 = ch.JA3()
+		fp.JA3Hash = MD5(fp.JA3)
+		fp.JA3N = ch.JA3N()
+		fp.JA3NHash = MD5(fp.JA3N)
+		fp.JA4 = ch.JA4()
+		fp.JA4R = ch.JA4R()
+		fp.JA4RO = ch.JA4RO()
+		if settings.UseHTTP2 {
+			for _, protocol := range ch.ALPN {
+				if protocol == "h2" {
+					fp.Protocol = "h2"
+				}
+			}
+		}
+	}
+
+	proto := "HTTP/1.1"
+	if fp.Protocol == "h2" {
+		proto = "HTTP/2.0"
+		fp.Akamai = Akamai(settings.HTTP2Settings, (*preq.Headers)[http.PHeaderOrderKey])
+		fp.AkamaiHash = MD5(fp.Akamai)
+	}
+	fp.JA4H = JA4H(preq.Method, proto, requestHeaders(preq, u, fp.Protocol == "h2"))
+	return fp, nil
+}
+
+// 生成与Transport相同的ClientHello
+func clientHello(host string, settings *requests.FingerprintSettings) ([]byte, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	config := &utls.Config{ServerName: host}
+	var conn *utls.UConn
+	if settings.Ja3 == "" && settings.Ja4 == "" {
+		if settings.UseHTTP2 {
+			config.NextProtos = []string{"h2", "http/1.1"}
+		}
+		conn = utls.UClient(client, config, utls.HelloGolang)
+	} else {
+		var spec *utls.ClientHelloSpec
+		var err error
+		if settings.Ja4 != "" {
+			spec, err = transport.NewClientHelloSpecFromJA4(settings.Ja4, settings.UserAgent, settings.TLSExtensions, settings.ExtraExtensions)
+		} else {
+			spec, err = transport.NewClientHelloSpec(settings.Ja3, settings.UserAgent, settings.TLSExtensions, settings.ExtraExtensions)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if settings.ForceHTTP1 {
+			transport.StripALPNProtocol(spec, "h2")
+		}
+		conn = utls.UClient(client, config, utls.HelloCustom)
+		if err = conn.ApplyPreset(spec); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.BuildHandshakeStateWithoutSession(); err != nil {
+		return nil, err
+	}
+	hello := conn.HandshakeState.Hello
+	if hello.Raw != nil {
+		return hello.Raw, nil
+	}
+	return hello.Marshal()
+}
+
+// 按chttp的排序规则得到实际发送的请求头
+func requestHeaders(preq *models.PrepareRequest, u *url2.URL, h2 bool) []HeaderField {
+	header := http.Header{}
+	for key, values := range *preq.Headers {
+		if key == http.HeaderOrderKey || key == http.PHeaderOrderKey || key == http.UnChangedHeaderKey || len(values) == 0 {
+			continue
+		}
+		header[key] = values
+	}
+	if !h2 && header.Get("Host") == "" {
+		header.Set("Host", u.Host)
+	}
+	if h2 {
+		header.Del("Host")
+		header.Del("Connection")
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", "Go-http-client/1.1")
+		if h2 {
+			header.Set("User-Agent", "Go-http-client/2.0")
+		}
+	}
+	if preq.Cookies != nil {
+		var cookies []string
+		for _, cookie := range preq.Cookies.Cookies(u) {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		if len(cookies) > 0 {
+			header.Set("Cookie", strings.Join(cookies, "; "))
+		}
+	}
+
+	order := make(map[string]int)
+	for i, key := range (*preq.Headers)[http.HeaderOrderKey] {
+		order[strings.ToLower(key)] = i
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		idxi, iok := order[strings.ToLower(keys[i])]
+		idxj, jok := order[strings.ToLower(keys[j])]
+		if iok && jok {
+			return idxi < idxj
+		}
+		if iok != jok {
+			return iok
+		}
+		return keys[i] < keys[j]
+	})
+
+	unchanged := make(map[string]string)
+	for _, key := range (*preq.Headers)[http.UnChangedHeaderKey] {
+		unchanged[strings.ToLower(key)] = key
+	}
+	var fields []HeaderField
+	for _, key := range keys {
+		name := key
+		if h2 {
+			name = strings.ToLower(key)
+		} else if n, ok := unchanged[strings.ToLower(key)]; ok {
+			name = n
+		}
+		fields = append(fields, HeaderField{Name: name, Value: header[key][0]})
+	}
+	// 未设置Accept-Encoding时chttp会在最后添加gzip
+	if header.Get("Accept-Encoding") == "" && preq.Method != http.MethodHead {
+		name := "Accept-Encoding"
+		if h2 {
+			name = "accept-encoding"
+		}
+		fields = append(fields, HeaderField{Name: name, Value: "gzip"})
+	}
+	return fields
+}
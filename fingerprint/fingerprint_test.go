@@ -0,0 +1,150 @@
+package fingerprint
+
+import (
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/profiles"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 将JA3中的扩展排序，与ClientHello.JA3N比较
+func sortJA3(ja3 string) string {
+	fields := strings.Split(ja3, ",")
+	extensions := strings.Split(fields[2], "-")
+	sort.Slice(extensions, func(i, j int) bool {
+		a, _ := strconv.Atoi(extensions[i])
+		b, _ := strconv.Atoi(extensions[j])
+		return a < b
+	})
+	fields[2] = strings.Join(extensions, "-")
+	return strings.Join(fields, ",")
+}
+
+// 每个内置模板实际发送的ClientHello都与模板声明的JA3一致
+func TestProfilesJA3(t *testing.T) {
+	for _, name := range profiles.Names() {
+		p, err := profiles.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session := requests.NewSession()
+		if err = session.ApplyProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		fp, err := Compute(session, "GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := sortJA3(p.JA3); fp.JA3N != want {
+			t.Errorf("%s: JA3N = %s, want %s", name, fp.JA3N, want)
+		}
+		// 关闭随机扩展顺序后按模板中的顺序发送
+		if extra := session.ExtraExtensions; extra != nil && extra.RandomExtensionOrder {
+			copied := *extra
+			copied.RandomExtensionOrder = false
+			session.ExtraExtensions = &copied
+			if fp, err = Compute(session, "GET", "https://example.com/", nil); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if fp.JA3 != p.JA3 {
+			t.Errorf("%s: JA3 = %s, want %s", name, fp.JA3, p.JA3)
+		}
+	}
+}
+
+// Chrome与Edge模板每次握手随机排列扩展顺序
+func TestProfilesRandomExtensionOrder(t *testing.T) {
+	for _, name := range profiles.Names() {
+		if !strings.HasPrefix(name, "chrome") && !strings.HasPrefix(name, "edge") {
+			continue
+		}
+		session := requests.NewSession()
+		if err := session.ApplyProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		orders := map[string]bool{}
+		for i := 0; i < 10; i++ {
+			fp, err := Compute(session, "GET", "https://example.com/", nil)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			orders[fp.JA3] = true
+		}
+		if len(orders) < 2 {
+			t.Errorf("%s: extension order did not change across 10 handshakes", name)
+		}
+	}
+}
+
+// 固定请求的参考指纹，哈希由独立的工具计算（JA3与Akamai为md5，JA4与JA4H为sha256的前12位），
+// 其中JA4与tls.peet.ws等公开数据中Chrome的JA4 t13d1516h2_8daaf6152771_02713d6af862相同
+func TestComputeReferenceValues(t *testing.T) {
+	const akamai = "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+	tests := []struct {
+		name string
+		ja3  string
+		ja4  string
+		want Fingerprint
+	}{
+		{
+			name: "ja3 ForceHTTP1",
+			ja3:  "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0",
+			want: Fingerprint{
+				JA3:     "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0",
+				JA3Hash: "e1d8b04eeb8ef3954ec4f49267a783ef",
+				JA4:     "t13d1515h1_8daaf6152771_4d8a99c1bc01",
+				JA4R:    "t13d1515h1_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0503,0603,0804,0805,0806,0401,0501,0601,0203,0201",
+				// Accept,Accept-Encoding,Accept-Language,Connection,Host,User-Agent，Cookie为a,b与a=1,b=2
+				JA4H:     "ge11cr06enus_73e49fadadc7_1eb7c54d5283_06beefe2b477",
+				Protocol: "http/1.1",
+			},
+		},
+		{
+			name: "ja4 h2",
+			ja4:  "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,fe0d,ff01_0403,0804,0401,0503,0805,0501,0806,0601",
+			want: Fingerprint{
+				JA3:     "771,47-53-156-157-4865-4866-4867-49171-49172-49195-49196-49199-49200-52392-52393,0-16-5-10-11-13-18-23-27-35-43-45-51-17513-65037-65281,29-23-24,0",
+				JA3Hash: "c3cb1bd6e410c252f07678bae53f039f",
+				JA4:     "t13d1516h2_8daaf6152771_02713d6af862",
+				JA4R:    "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,4469,fe0d,ff01_0403,0804,0401,0503,0805,0501,0806,0601",
+				// accept,accept-encoding,accept-language,user-agent
+				JA4H:       "ge20cr04enus_b74aa5121121_1eb7c54d5283_06beefe2b477",
+				Akamai:     akamai,
+				AkamaiHash: "52d84b11737d980aef856699f885ca86",
+				Protocol:   "h2",
+			},
+		},
+	}
+	h2Settings, err := transport.ParseAkamaiFingerprint(akamai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		session := requests.NewSession()
+		session.Ja3, session.Ja4 = test.ja3, test.ja4
+		req := url.NewRequest()
+		req.Headers = url.NewHeaders()
+		req.Headers.Set("User-Agent", "test")
+		req.Headers.Set("Accept-Language", "en-US,en;q=0.9")
+		req.Headers.Set("Cookie", "b=2; a=1")
+		req.Headers.Set("Referer", "https://example.com/")
+		req.ForceHTTP1 = test.ja3 != ""
+		if req.HTTP2Settings, err = transport.ToHTTP2Settings(h2Settings); err != nil {
+			t.Fatal(err)
+		}
+		fp, err := Compute(session, "GET", "https://example.com/", req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got := Fingerprint{JA3: fp.JA3, JA3Hash: fp.JA3Hash, JA4: fp.JA4, JA4R: fp.JA4R, JA4H: fp.JA4H, Akamai: fp.Akamai, AkamaiHash: fp.AkamaiHash, Protocol: fp.Protocol}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Compute = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package fingerprint
+
+import (
+	"fmt"
+	http "github.com/wangluozhe/chttp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 未设置HTTP2Settings时chttp发送的默认设置
+var defaultHTTP2Settings = &http.HTTP2Settings{
+	Settings: []http.HTTP2Setting{
+		{ID: http.HTTP2SettingEnablePush, Val: 0},
+		{ID: http.HTTP2SettingInitialWindowSize, Val: 4 << 20},
+		{ID: http.HTTP2SettingMaxHeaderListSize, Val: 10 << 20},
+	},
+	ConnectionFlow: 1 << 30,
+}
+
+// 请求头字段
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// 计算JA4H，proto为HTTP/1.1或HTTP/2.0，headers为按发送顺序排列的请求头，不含伪头部
+func JA4H(method, proto string, headers []HeaderField) string {
+	a, names, cookies := ja4hParts(method, proto, headers)
+	var cookieNames, cookieFields []string
+	for _, cookie := range cookies {
+		cookieFields = append(cookieFields, cookie)
+		cookieNames = append(cookieNames, strings.SplitN(cookie, "=", 2)[0])
+	}
+	sort.Strings(cookieNames)
+	sort.Strings(cookieFields)
+	return a + "_" + hash12(strings.Join(names, ",")) + "_" + hash12(strings.Join(cookieNames, ",")) + "_" + hash12(strings.Join(cookieFields, ","))
+}
+
+// JA4H的a部分、参与计算的请求头名称以及Cookie
+func ja4hParts(method, proto string, headers []HeaderField) (string, []string, []string) {
+	method = strings.ToLower(method)
+	if len(method) > 2 {
+		method = method[:2]
+	}
+	version := "11"
+	switch proto {
+	case "HTTP/2.0", "HTTP/2", "h2":
+		version = "20"
+	case "HTTP/3.0", "HTTP/3", "h3":
+		version = "30"
+	case "HTTP/1.0":
+		version = "10"
+	}
+	cookie, referer, language := "n", "n", "0000"
+	var names, cookies []string
+	for _, header := range headers {
+		switch strings.ToLower(header.Name) {
+		case "cookie":
+			cookie = "c"
+			for _, field := range strings.Split(header.Value, ";") {
+				if field = strings.TrimSpace(field); field != "" {
+					cookies = append(cookies, field)
+				}
+			}
+			continue
+		case "referer":
+			referer = "r"
+			continue
+		case "accept-language":
+			lang := strings.ToLower(strings.ReplaceAll(header.Value, "-", ""))
+			lang = strings.Split(strings.Split(lang, ",")[0], ";")[0]
+			if len(lang) > 4 {
+				lang = lang[:4]
+			}
+			language = lang + strings.Repeat("0", 4-len(lang))
+		}
+		names = append(names, header.Name)
+	}
+	a := fmt.Sprintf("%s%s%s%s%02d%s", method, version, cookie, referer, min(len(names), 99), language)
+	return a, names, cookies
+}
+
+// 计算Akamai HTTP2指纹，settings为nil时使用chttp的默认设置
+func Akamai(settings *http.HTTP2Settings, pseudoHeaderOrder []string) string {
+	if settings == nil {
+		settings = defaultHTTP2Settings
+	}
+	var parts []string
+	for _, setting := range settings.Settings {
+		parts = append(parts, fmt.Sprintf("%d:%d", setting.ID, setting.Val))
+	}
+	if len(settings.Settings) == 0 {
+		for _, setting := range defaultHTTP2Settings.Settings {
+			parts = append(parts, fmt.Sprintf("%d:%d", setting.ID, setting.Val))
+		}
+	}
+	windowUpdate := settings.ConnectionFlow
+	if windowUpdate == 0 {
+		windowUpdate = defaultHTTP2Settings.ConnectionFlow
+	}
+	priority := "0"
+	if len(settings.PriorityFrames) > 0 {
+		var frames []string
+		for _, frame := range settings.PriorityFrames {
+			exclusive := 0
+			if frame.Exclusive {
+				exclusive = 1
+			}
+			frames = append(frames, fmt.Sprintf("%d:%d:%d:%d", frame.StreamID, exclusive, frame.StreamDep, int(frame.Weight)+1))
+		}
+		priority = strings.Join(frames, ",")
+	}
+	var pseudo []string
+	for _, header := range pseudoHeaderOrder {
+		if len(header) > 1 {
+			pseudo = append(pseudo, header[1:2])
+		}
+	}
+	return strings.Join([]string{strings.Join(parts, ";"), strconv.Itoa(windowUpdate), priority, strings.Join(pseudo, ",")}, "|")
+}
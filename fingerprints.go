@@ -0,0 +1,89 @@
+package requests
+
+import (
+	"errors"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+)
+
+// 一次请求实际使用的指纹设置，由Session与请求中的设置合并而来，发送请求与fingerprint.Compute共用
+type FingerprintSettings struct {
+	Ja3             string
+	Ja4             string
+	UserAgent       string // 设置了JA3或JA4时取自请求头，用于生成与浏览器一致的扩展
+	TLSExtensions   *http.TLSExtensions
+	ExtraExtensions *transport.ExtraExtensions
+	HTTP2Settings   *http.HTTP2Settings
+	ForceHTTP1      bool
+	ForceHTTP2      bool
+	UseHTTP2        bool // 是否在ALPN中提供h2并为Transport配置HTTP2
+}
+
+// 将请求头中的有序请求头设置复制到preq，需在FingerprintSettings之前调用
+func MergeHeaderOrder(preq *models.PrepareRequest, req *url.Request) {
+	if req.Headers == nil {
+		return
+	}
+	for _, key := range []string{http.HeaderOrderKey, http.PHeaderOrderKey, http.UnChangedHeaderKey} {
+		if (*req.Headers)[key] != nil {
+			(*preq.Headers)[key] = (*req.Headers)[key]
+		}
+	}
+}
+
+// 合并Session与请求中的指纹设置：
+// 请求中的Ja3或Ja4整体替换Session的设置，TLSExtensions与ExtraExtensions作为一组替换，HTTP2Settings单独替换
+func (s *Session) FingerprintSettings(preq *models.PrepareRequest, req *url.Request) (*FingerprintSettings, error) {
+	if req.ForceHTTP1 && req.ForceHTTP2 {
+		return nil, errors.New("ForceHTTP1 and ForceHTTP2 cannot both be set")
+	}
+	settings := &FingerprintSettings{
+		Ja3:             s.Ja3,
+		Ja4:             s.Ja4,
+		TLSExtensions:   s.TLSExtensions,
+		ExtraExtensions: s.ExtraExtensions,
+		HTTP2Settings:   merge_setting(req.HTTP2Settings, s.HTTP2Settings).(*http.HTTP2Settings),
+		ForceHTTP1:      req.ForceHTTP1,
+		ForceHTTP2:      req.ForceHTTP2,
+	}
+	if req.Ja3 != "" || req.Ja4 != "" {
+		settings.Ja3, settings.Ja4 = req.Ja3, req.Ja4
+	}
+	if settings.Ja3 != "" && settings.Ja4 != "" {
+		return nil, errors.New("Ja3 and Ja4 cannot both be set")
+	}
+	if req.TLSExtensions != nil || req.ExtraExtensions != nil {
+		settings.TLSExtensions, settings.ExtraExtensions = req.TLSExtensions, req.ExtraExtensions
+	}
+	if settings.Ja3 == "" && settings.Ja4 == "" {
+		settings.UseHTTP2 = settings.ForceHTTP2
+		return settings, nil
+	}
+	settings.UserAgent = preq.Headers.Get("User-Agent")
+
+	// JA3默认提供h2，JA4按其中的ALPN，显式设置的ALPN列表优先
+	useHTTP2 := settings.Ja3 != ""
+	if settings.Ja4 != "" {
+		spec, err := transport.ParseJA4(settings.Ja4)
+		if err != nil {
+			return nil, err
+		}
+		useHTTP2 = containsH2(spec.ALPN)
+	}
+	if extra := settings.ExtraExtensions; extra != nil && extra.ALPN != nil {
+		useHTTP2 = containsH2(extra.ALPN)
+	}
+	settings.UseHTTP2 = (useHTTP2 && !settings.ForceHTTP1) || settings.ForceHTTP2
+	return settings, nil
+}
+
+func containsH2(protocols []string) bool {
+	for _, protocol := range protocols {
+		if protocol == "h2" {
+			return true
+		}
+	}
+	return false
+}
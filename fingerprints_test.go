@@ -0,0 +1,93 @@
+package requests
+
+import (
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/profiles"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"testing"
+)
+
+const testJA4 = "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0017,001b,0023,002b,002d,0033,44cd,fe0d,ff01_0403,0804,0401,0503,0805,0501,0806,0601"
+
+func TestFingerprintSettings(t *testing.T) {
+	session := NewSession()
+	session.Ja3 = testJA3
+	session.TLSExtensions = &http.TLSExtensions{}
+	session.ExtraExtensions = &transport.ExtraExtensions{ALPN: []string{"h2"}}
+	preq := &models.PrepareRequest{Headers: &http.Header{"User-Agent": {"ua"}}}
+
+	tests := []struct {
+		name     string
+		req      func(*url.Request)
+		ja3, ja4 string
+		extra    bool
+		useHTTP2 bool
+		err      bool
+	}{
+		{name: "session", ja3: testJA3, extra: true, useHTTP2: true},
+		{name: "ForceHTTP1", req: func(r *url.Request) { r.ForceHTTP1 = true }, ja3: testJA3, extra: true},
+		{name: "JA4", req: func(r *url.Request) { r.Ja4 = testJA4 }, ja4: testJA4, extra: true, useHTTP2: true},
+		{name: "JA4 http/1.1", req: func(r *url.Request) {
+			r.Ja4 = testJA4[:8] + "h1" + testJA4[10:]
+			r.ExtraExtensions = &transport.ExtraExtensions{}
+		}, ja4: testJA4[:8] + "h1" + testJA4[10:]},
+		{name: "extra ALPN", req: func(r *url.Request) {
+			r.ExtraExtensions = &transport.ExtraExtensions{ALPN: []string{"http/1.1"}}
+		}, ja3: testJA3, extra: true},
+		{name: "both fingerprints", req: func(r *url.Request) { r.Ja3, r.Ja4 = testJA3, testJA4 }, err: true},
+		{name: "both protocols", req: func(r *url.Request) { r.ForceHTTP1, r.ForceHTTP2 = true, true }, err: true},
+	}
+	for _, test := range tests {
+		req := url.NewRequest()
+		if test.req != nil {
+			test.req(req)
+		}
+		settings, err := session.FingerprintSettings(preq, req)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if settings.Ja3 != test.ja3 || settings.Ja4 != test.ja4 || settings.UseHTTP2 != test.useHTTP2 || settings.UserAgent != "ua" {
+			t.Errorf("%s: got %+v", test.name, settings)
+		}
+		// 请求中的TLSExtensions与ExtraExtensions作为一组替换Session的设置
+		if replaced := req.ExtraExtensions != nil; (settings.TLSExtensions == session.TLSExtensions) == replaced {
+			t.Errorf("%s: TLSExtensions not replaced together with ExtraExtensions", test.name)
+		}
+		if test.extra != (settings.ExtraExtensions != nil && settings.ExtraExtensions.ALPN != nil) {
+			t.Errorf("%s: ExtraExtensions = %+v", test.name, settings.ExtraExtensions)
+		}
+	}
+}
+
+// 应用模板后不再保留之前设置的JA4，否则请求会因同时设置JA3与JA4而失败
+func TestApplyProfileClearsJa4(t *testing.T) {
+	session := NewSession()
+	session.Ja4 = testJA4
+	if err := session.ApplyProfile("firefox_128"); err != nil {
+		t.Fatal(err)
+	}
+	preq := &models.PrepareRequest{Headers: &http.Header{}}
+	settings, err := session.FingerprintSettings(preq, url.NewRequest())
+	if err != nil || settings.Ja4 != "" || settings.Ja3 == "" {
+		t.Fatalf("session settings = %+v, err = %v", settings, err)
+	}
+
+	profile, err := profiles.Get("firefox_128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := url.NewRequest()
+	req.Ja4 = testJA4
+	profile.ApplyRequest(req)
+	if settings, err = NewSession().FingerprintSettings(preq, req); err != nil || settings.Ja4 != "" || settings.Ja3 != profile.JA3 {
+		t.Fatalf("request settings = %+v, err = %v", settings, err)
+	}
+}
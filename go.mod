@@ -6,9 +6,10 @@ require (
 	github.com/andybalholm/brotli v1.1.1
 	github.com/bitly/go-simplejson v0.5.0
 	github.com/google/uuid v1.3.0
-	github.com/refraction-networking/utls v1.6.8-0.20250302025818-5ce39b85e60b
+	github.com/refraction-networking/utls v1.8.2
 	github.com/wangluozhe/chttp v1.0.8
-	golang.org/x/crypto v0.35.0
+	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
 )
 
 require (
@@ -16,7 +17,6 @@ require (
 	github.com/cloudflare/circl v1.6.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
-	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
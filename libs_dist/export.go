@@ -6,14 +6,19 @@ package main
 import "C"
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	utls "github.com/refraction-networking/utls"
 	http "github.com/wangluozhe/chttp"
 	"github.com/wangluozhe/chttp/cookiejar"
 	"github.com/wangluozhe/requests"
 	"github.com/wangluozhe/requests/libs"
+	"github.com/wangluozhe/requests/profiles"
 	ja3 "github.com/wangluozhe/requests/transport"
 	"github.com/wangluozhe/requests/url"
 	"github.com/wangluozhe/requests/utils"
@@ -28,27 +33,134 @@ var unsafePointers = make(map[string]*C.char)
 var unsafePointersLock = sync.Mutex{}
 var errorFormat = "{\"err\": \"%v\"}"
 
-var sessionsPool = make(map[string]*sync.Pool)
-var sessionsPoolLock = sync.Mutex{}
+// 以Id区分的Session，调用closeSession后释放
+var sessions = make(map[string]*requests.Session)
+var sessionsLock = sync.Mutex{}
 
 func GetSession(id string) *requests.Session {
-	sessionsPoolLock.Lock()
-	defer sessionsPoolLock.Unlock()
-	if sp, ok := sessionsPool[id]; ok {
-		s := sp.Get().(*requests.Session)
-		sp.Put(s)
-		return s
-	}
-	sp := &sync.Pool{
-		New: func() interface{} {
-			return requests.NewSession()
-		},
-	}
-	sessionsPool[id] = sp
-	s := sp.Get().(*requests.Session)
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		s = requests.NewSession()
+		sessions[id] = s
+	}
 	return s
 }
 
+//export closeSession
+func closeSession(idChar *C.char) {
+	id := C.GoString(idChar)
+	sessionsLock.Lock()
+	s, ok := sessions[id]
+	delete(sessions, id)
+	sessionsLock.Unlock()
+	if ok {
+		s.Close()
+	}
+}
+
+//export sessionStats
+func sessionStats(idChar *C.char) *C.char {
+	id := C.GoString(idChar)
+	sessionsLock.Lock()
+	s, ok := sessions[id]
+	sessionsLock.Unlock()
+	if !ok {
+		return C.CString(fmt.Sprintf(errorFormat, "sessionStats->session "+id+" not found"))
+	}
+	stats, err := json.Marshal(s.Stats())
+	if err != nil {
+		return C.CString(fmt.Sprintf(errorFormat, "sessionStats->stats, err := json.Marshal(s.Stats()) failed: "+err.Error()))
+	}
+	return C.CString(string(stats))
+}
+
+// 将Cookie操作的结果转为JSON，出错时返回错误信息
+func cookieResult(name string, result interface{}, err error) *C.char {
+	if err != nil {
+		return C.CString(fmt.Sprintf(errorFormat, name+" failed: "+err.Error()))
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return C.CString(fmt.Sprintf(errorFormat, name+"->json.Marshal(result) failed: "+err.Error()))
+	}
+	return C.CString(string(data))
+}
+
+//export cookiesAll
+func cookiesAll(idChar *C.char) *C.char {
+	cookies := GetSession(C.GoString(idChar)).CookieJar().All()
+	return cookieResult("cookiesAll", cookies, nil)
+}
+
+//export cookiesForDomain
+func cookiesForDomain(idChar, domainChar *C.char) *C.char {
+	cookies := GetSession(C.GoString(idChar)).CookieJar().ForDomain(C.GoString(domainChar))
+	return cookieResult("cookiesForDomain", cookies, nil)
+}
+
+//export cookiesGet
+func cookiesGet(idChar, nameChar, domainChar *C.char) *C.char {
+	cookie := GetSession(C.GoString(idChar)).CookieJar().Get(C.GoString(nameChar), C.GoString(domainChar))
+	return cookieResult("cookiesGet", cookie, nil)
+}
+
+// cookieChar为requests.Cookie的JSON
+//
+//export cookiesSet
+func cookiesSet(idChar, cookieChar *C.char) *C.char {
+	c := requests.Cookie{}
+	if err := json.Unmarshal([]byte(C.GoString(cookieChar)), &c); err != nil {
+		return cookieResult("cookiesSet->json.Unmarshal(cookie)", nil, err)
+	}
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	err := GetSession(C.GoString(idChar)).CookieJar().Set(cookie)
+	return cookieResult("cookiesSet", map[string]interface{}{"ok": err == nil}, err)
+}
+
+//export cookiesDelete
+func cookiesDelete(idChar, nameChar, domainChar *C.char) *C.char {
+	n := GetSession(C.GoString(idChar)).CookieJar().Delete(C.GoString(nameChar), C.GoString(domainChar))
+	return cookieResult("cookiesDelete", map[string]interface{}{"count": n}, nil)
+}
+
+// domainChar为空时删除全部Cookie
+//
+//export cookiesClear
+func cookiesClear(idChar, domainChar *C.char) *C.char {
+	n := GetSession(C.GoString(idChar)).CookieJar().Clear(C.GoString(domainChar))
+	return cookieResult("cookiesClear", map[string]interface{}{"count": n}, nil)
+}
+
+// expires为Unix时间戳（秒），为0时改为会话Cookie，早于当前时间时删除
+//
+//export cookiesExpire
+func cookiesExpire(idChar, nameChar, domainChar *C.char, expires C.longlong) *C.char {
+	var t time.Time
+	if expires != 0 {
+		t = time.Unix(int64(expires), 0)
+	}
+	n := GetSession(C.GoString(idChar)).CookieJar().Expire(C.GoString(nameChar), C.GoString(domainChar), t)
+	return cookieResult("cookiesExpire", map[string]interface{}{"count": n}, nil)
+}
+
 //export request
 func request(requestParamsChar *C.char) *C.char {
 	requestParamsString := C.GoString(requestParamsChar)
@@ -68,7 +180,6 @@ func request(requestParamsChar *C.char) *C.char {
 	if err != nil {
 		return C.CString(fmt.Sprintf(errorFormat, "request->response, err := GetSession(requestParams.Id).Request(requestParams.Method, requestParams.Url, req) failed: "+err.Error()))
 	}
-	sessionsPool[requestParams.Id].Put(session)
 
 	responseParams := make(map[string]interface{})
 	responseParams["id"] = uuid.New().String()
@@ -76,7 +187,10 @@ func request(requestParamsChar *C.char) *C.char {
 	responseParams["headers"] = response.Headers
 	responseParams["cookies"] = response.Cookies
 	responseParams["status_code"] = response.StatusCode
-	responseParams["content"] = utils.Base64Encode(response.Text)
+	responseParams["content"] = utils.Base64Encode(string(response.Content))
+	responseParams["encoding"] = response.Encoding
+	responseParams["proto"] = response.Proto
+	responseParams["tls"] = tlsState(response.TLS)
 
 	responseParamsString, err := json.Marshal(responseParams)
 	if err != nil {
@@ -91,6 +205,39 @@ func request(requestParamsChar *C.char) *C.char {
 	return responseString
 }
 
+// 转换TLS连接状态，证书使用PEM编码，OCSP响应与SCT使用Base64编码，明文请求返回nil
+func tlsState(state *utls.ConnectionState) map[string]interface{} {
+	if state == nil {
+		return nil
+	}
+	certificates := func(certs []*x509.Certificate) []string {
+		list := make([]string, 0, len(certs))
+		for _, cert := range certs {
+			list = append(list, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+		}
+		return list
+	}
+	verifiedChains := make([][]string, 0, len(state.VerifiedChains))
+	for _, chain := range state.VerifiedChains {
+		verifiedChains = append(verifiedChains, certificates(chain))
+	}
+	timestamps := make([]string, 0, len(state.SignedCertificateTimestamps))
+	for _, sct := range state.SignedCertificateTimestamps {
+		timestamps = append(timestamps, base64.StdEncoding.EncodeToString(sct))
+	}
+	return map[string]interface{}{
+		"version":                       utls.VersionName(state.Version),
+		"cipher_suite":                  utls.CipherSuiteName(state.CipherSuite),
+		"negotiated_protocol":           state.NegotiatedProtocol,
+		"did_resume":                    state.DidResume,
+		"server_name":                   state.ServerName,
+		"peer_certificates":             certificates(state.PeerCertificates),
+		"verified_chains":               verifiedChains,
+		"ocsp_response":                 base64.StdEncoding.EncodeToString(state.OCSPResponse),
+		"signed_certificate_timestamps": timestamps,
+	}
+}
+
 func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 	if requestParams.Method == "" {
 		return nil, errors.New("method is null")
@@ -125,6 +272,14 @@ func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 		}
 	}
 
+	if requestParams.Profile != "" {
+		profile, err := profiles.Get(requestParams.Profile)
+		if err != nil {
+			return nil, err
+		}
+		profile.ApplyRequest(req)
+	}
+
 	if requestParams.Cookies != nil {
 		cookies, _ := cookiejar.New(nil)
 		u, _ := url2.Parse(requestParams.Url)
@@ -162,13 +317,35 @@ func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 		req.Timeout = time.Duration(timeout) * time.Second
 	}
 
+	// 分阶段超时，单位为秒
+	if requestParams.ConnectTimeout != 0 || requestParams.TLSHandshakeTimeout != 0 || requestParams.ResponseHeaderTimeout != 0 || requestParams.BodyIdleTimeout != 0 {
+		req.Timeouts = &url.Timeouts{
+			Connect:        time.Duration(requestParams.ConnectTimeout) * time.Second,
+			TLSHandshake:   time.Duration(requestParams.TLSHandshakeTimeout) * time.Second,
+			ResponseHeader: time.Duration(requestParams.ResponseHeaderTimeout) * time.Second,
+			BodyIdle:       time.Duration(requestParams.BodyIdleTimeout) * time.Second,
+		}
+	}
+
 	req.AllowRedirects = requestParams.AllowRedirects
 
 	if requestParams.Proxies != "" {
 		req.Proxies = requestParams.Proxies
 	}
 
-	req.Verify = requestParams.Verify
+	if requestParams.ProxyHeaders != nil {
+		proxyHeaders := &http.Header{}
+		for key, value := range requestParams.ProxyHeaders {
+			proxyHeaders.Set(key, value)
+		}
+		if requestParams.ProxyHeadersOrder != nil {
+			(*proxyHeaders)[http.HeaderOrderKey] = requestParams.ProxyHeadersOrder
+		}
+		req.ProxyHeaders = proxyHeaders
+	}
+
+	// url.Request的Verify已不再生效，显式传入的Verify=false映射为InsecureSkipVerify
+	req.InsecureSkipVerify = requestParams.InsecureSkipVerify || (requestParams.Verify != nil && !*requestParams.Verify)
 
 	if requestParams.Cert != nil {
 		req.Cert = requestParams.Cert
@@ -178,10 +355,18 @@ func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 		req.Ja3 = requestParams.Ja3
 	}
 
+	if requestParams.Ja4 != "" {
+		req.Ja4 = requestParams.Ja4
+	}
+
 	if requestParams.ForceHTTP1 {
 		req.ForceHTTP1 = requestParams.ForceHTTP1
 	}
 
+	if requestParams.ForceHTTP2 {
+		req.ForceHTTP2 = requestParams.ForceHTTP2
+	}
+
 	if requestParams.PseudoHeaderOrder != nil {
 		(*req.Headers)[http.PHeaderOrderKey] = requestParams.PseudoHeaderOrder
 	}
@@ -192,7 +377,31 @@ func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 		if err != nil {
 			return nil, err
 		}
-		req.TLSExtensions = ja3.ToTLSExtensions(tlsExtensions)
+		req.TLSExtensions, err = ja3.ToTLSExtensions(tlsExtensions)
+		if err != nil {
+			return nil, err
+		}
+		req.ExtraExtensions, err = ja3.ToExtraExtensions(tlsExtensions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if requestParams.AkamaiFingerprint != "" {
+		http2Settings, err := ja3.ParseAkamaiFingerprint(requestParams.AkamaiFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		req.HTTP2Settings, err = ja3.ToHTTP2Settings(http2Settings)
+		if err != nil {
+			return nil, err
+		}
+		if requestParams.PseudoHeaderOrder == nil && http2Settings.PseudoHeaderOrder != nil {
+			if req.Headers == nil {
+				req.Headers = url.NewHeaders()
+			}
+			(*req.Headers)[http.PHeaderOrderKey] = http2Settings.PseudoHeaderOrder
+		}
 	}
 
 	if requestParams.HTTP2Settings != "" {
@@ -201,7 +410,10 @@ func buildRequest(requestParams libs.RequestParams) (*url.Request, error) {
 		if err != nil {
 			return nil, err
 		}
-		req.HTTP2Settings = ja3.ToHTTP2Settings(http2Settings)
+		req.HTTP2Settings, err = ja3.ToHTTP2Settings(http2Settings)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return req, nil
 }
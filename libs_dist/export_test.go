@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/libs"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// 绑定传入的Verify=false跳过证书校验，未传入或为true时校验
+func TestBuildRequestVerify(t *testing.T) {
+	server := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		params string
+		ok     bool
+	}{
+		{params: `{}`, ok: false},
+		{params: `{"Verify": true}`, ok: false},
+		{params: `{"Verify": false}`, ok: true},
+		{params: `{"InsecureSkipVerify": true}`, ok: true},
+		{params: `{"Verify": true, "InsecureSkipVerify": true}`, ok: true},
+	}
+	for _, test := range tests {
+		requestParams := libs.RequestParams{}
+		if err := json.Unmarshal([]byte(test.params), &requestParams); err != nil {
+			t.Fatal(err)
+		}
+		requestParams.Method = "GET"
+		requestParams.Url = server.URL
+		req, err := buildRequest(requestParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := requests.NewSession().Request(requestParams.Method, requestParams.Url, req)
+		if test.ok && (err != nil || r.Text != "ok") {
+			t.Errorf("%s: err = %v", test.params, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: request to a server with an untrusted certificate succeeded", test.params)
+		}
+	}
+}
+
+// AkamaiFingerprint转换为HTTP2Settings并设置伪头部顺序，无效时返回错误
+func TestBuildRequestAkamaiFingerprint(t *testing.T) {
+	req, err := buildRequest(libs.RequestParams{Method: "GET", Url: "https://example.com", AkamaiFingerprint: "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := []http.HTTP2Setting{
+		{ID: http.HTTP2SettingHeaderTableSize, Val: 65536},
+		{ID: http.HTTP2SettingEnablePush},
+		{ID: http.HTTP2SettingInitialWindowSize, Val: 6291456},
+		{ID: http.HTTP2SettingMaxHeaderListSize, Val: 262144},
+	}
+	if req.HTTP2Settings == nil || !reflect.DeepEqual(req.HTTP2Settings.Settings, settings) || req.HTTP2Settings.ConnectionFlow != 15663105 {
+		t.Fatalf("HTTP2Settings = %+v", req.HTTP2Settings)
+	}
+	if order := (*req.Headers)[http.PHeaderOrderKey]; !reflect.DeepEqual(order, []string{":method", ":authority", ":scheme", ":path"}) {
+		t.Fatalf("pseudo header order = %v", order)
+	}
+
+	if _, err = buildRequest(libs.RequestParams{Method: "GET", Url: "https://example.com", AkamaiFingerprint: "1:65536|15663105|0"}); err == nil {
+		t.Fatal("invalid AkamaiFingerprint was accepted")
+	}
+}
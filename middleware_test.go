@@ -0,0 +1,183 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/url"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 请求上下文中的中间件在Session的中间件之后执行，只作用于该请求
+func TestRequestMiddlewares(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {}))
+	defer server.Close()
+	var calls []string
+	hook := func(name string) models.Middleware {
+		return &models.Hooks{Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+			calls = append(calls, name)
+			return nil, nil
+		}}
+	}
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares, hook("session"))
+	req := url.NewRequest()
+	ctx := models.WithMiddlewares(context.Background(), hook("a"))
+	req.Context = models.WithMiddlewares(ctx, hook("b"))
+	if _, err := session.Get(server.URL, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"session", "a", "b", "session"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	if n := len(models.MiddlewaresFrom(ctx)); n != 1 {
+		t.Fatalf("parent context has %d middlewares, want 1", n)
+	}
+}
+
+// BeforeRequest返回Response时不再发送请求，也不再执行后续中间件
+func TestMiddlewareShortCircuit(t *testing.T) {
+	server := newRedirectServer(t, false)
+	var calls []string
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares,
+		&models.Hooks{Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+			calls = append(calls, "cache")
+			return &models.Response{StatusCode: 200, Text: "cached"}, nil
+		}},
+		&models.Hooks{
+			Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+				calls = append(calls, "before")
+				return nil, nil
+			},
+			After: func(resp *models.Response) (bool, error) {
+				calls = append(calls, "after")
+				return false, nil
+			},
+		},
+	)
+	req := url.NewRequest()
+	r, err := session.Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Text != "cached" || r.Request != req {
+		t.Fatalf("text = %q, request = %p, want %p", r.Text, r.Request, req)
+	}
+	if len(server.received) != 0 {
+		t.Fatalf("server received %d requests", len(server.received))
+	}
+	if want := []string{"cache"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+// BeforeRequest对请求的改写会被发送
+func TestMiddlewareRewrite(t *testing.T) {
+	server := newRedirectServer(t, false)
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares, &models.Hooks{Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+		preq.Method = "PUT"
+		preq.Url = server.URL + "/rewritten"
+		preq.Headers.Set("X-Token", "secret")
+		preq.Body = strings.NewReader("rewritten")
+		return nil, nil
+	}})
+	req := url.NewRequest()
+	req.Body = strings.NewReader("payload")
+	if _, err := session.Post(server.URL+"/original", req); err != nil {
+		t.Fatal(err)
+	}
+	last := server.last()
+	if last.method != "PUT" || last.path != "/rewritten" || last.body != "rewritten" || last.header.Get("X-Token") != "secret" {
+		t.Fatalf("server received %s %s body %q, X-Token %q", last.method, last.path, last.body, last.header.Get("X-Token"))
+	}
+}
+
+// AfterResponse按相反顺序执行，返回true时重新执行BeforeRequest并发送相同的请求体
+func TestMiddlewareResend(t *testing.T) {
+	server := newRedirectServer(t, false)
+	var calls []string
+	hook := func(name string, resend bool) models.Middleware {
+		return &models.Hooks{
+			Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+				calls = append(calls, "before "+name)
+				return nil, nil
+			},
+			After: func(resp *models.Response) (bool, error) {
+				calls = append(calls, "after "+name)
+				// 只在第一次收到响应时要求重新发送
+				return resend && len(calls) == 3, nil
+			},
+		}
+	}
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares, hook("a", false), hook("b", true))
+	req := url.NewRequest()
+	req.Body = strings.NewReader("payload")
+	r, err := session.Post(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Text != "ok" {
+		t.Fatalf("text = %q", r.Text)
+	}
+	if len(server.received) != 2 || server.received[0].body != "payload" || server.received[1].body != "payload" {
+		t.Fatalf("server received %+v", server.received)
+	}
+	want := []string{"before a", "before b", "after b", "after a", "before a", "before b", "after b", "after a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+// 重新发送超过DEFAULT_RESEND_LIMIT次时返回错误
+func TestMiddlewareResendLimit(t *testing.T) {
+	server := newRedirectServer(t, false)
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares, &models.Hooks{After: func(resp *models.Response) (bool, error) {
+		return true, nil
+	}})
+	_, err := session.Get(server.URL, nil)
+	if err == nil || !strings.Contains(err.Error(), "more than 10 resends") {
+		t.Fatalf("err = %v, want more than 10 resends", err)
+	}
+	if n := len(server.received); n != DEFAULT_RESEND_LIMIT+1 {
+		t.Fatalf("server received %d requests, want %d", n, DEFAULT_RESEND_LIMIT+1)
+	}
+}
+
+// 中间件返回的错误直接返回给调用方
+func TestMiddlewareErrors(t *testing.T) {
+	server := newRedirectServer(t, false)
+	errBefore := errors.New("before")
+	session := NewSession()
+	session.Middlewares = append(session.Middlewares, &models.Hooks{Before: func(preq *models.PrepareRequest) (*models.Response, error) {
+		return nil, errBefore
+	}})
+	if _, err := session.Get(server.URL, nil); !errors.Is(err, errBefore) {
+		t.Fatalf("err = %v, want %v", err, errBefore)
+	}
+	if len(server.received) != 0 {
+		t.Fatalf("server received %d requests", len(server.received))
+	}
+
+	errAfter := errors.New("after")
+	session = NewSession()
+	session.Middlewares = append(session.Middlewares, &models.Hooks{After: func(resp *models.Response) (bool, error) {
+		return false, errAfter
+	}})
+	if _, err := session.Get(server.URL, nil); !errors.Is(err, errAfter) {
+		t.Fatalf("err = %v, want %v", err, errAfter)
+	}
+	if len(server.received) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(server.received))
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import "context"
+
+// 中间件，BeforeRequest按注册顺序执行，AfterResponse按相反顺序执行
+type Middleware interface {
+	// 发送前调用，可改写预处理后的请求；返回非nil的Response时不再发送，直接将其作为结果返回
+	BeforeRequest(preq *PrepareRequest) (*Response, error)
+	// 收到响应后调用，返回true时重新发送请求（会重新执行所有BeforeRequest）
+	AfterResponse(resp *Response) (bool, error)
+}
+
+// 以函数形式定义的中间件，未设置的函数不做处理
+type Hooks struct {
+	Before func(preq *PrepareRequest) (*Response, error)
+	After  func(resp *Response) (bool, error)
+}
+
+func (h *Hooks) BeforeRequest(preq *PrepareRequest) (*Response, error) {
+	if h.Before == nil {
+		return nil, nil
+	}
+	return h.Before(preq)
+}
+
+func (h *Hooks) AfterResponse(resp *Response) (bool, error) {
+	if h.After == nil {
+		return false, nil
+	}
+	return h.After(resp)
+}
+
+type middlewaresKey struct{}
+
+// 返回附带中间件的上下文，设置为请求的Context后这些中间件只作用于该请求，在Session的中间件之后执行。
+// url.Request被models.Response引用，无法在url包中声明引用models类型的字段，因此通过上下文传递
+func WithMiddlewares(ctx context.Context, middlewares ...Middleware) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, middlewaresKey{}, append(MiddlewaresFrom(ctx), middlewares...))
+}
+
+// 获取上下文附带的中间件
+func MiddlewaresFrom(ctx context.Context) []Middleware {
+	if ctx == nil {
+		return nil
+	}
+	middlewares, _ := ctx.Value(middlewaresKey{}).([]Middleware)
+	// 复制一份，避免追加时改写父上下文中的列表
+	return append([]Middleware(nil), middlewares...)
+}
@@ -1,12 +1,19 @@
 package models
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/bitly/go-simplejson"
+	utls "github.com/refraction-networking/utls"
 	"github.com/wangluozhe/chttp"
 	"github.com/wangluozhe/requests/url"
 	"io"
+	"io/ioutil"
+	"iter"
+	"strings"
+	"time"
 )
 
 var RedirectStatusCodes = []int{
@@ -40,29 +47,156 @@ func inPermanentRedirectStatusCodes(statusCode int) bool {
 	return false
 }
 
+// 一次请求尝试的记录
+type Attempt struct {
+	StatusCode int           // 响应状态码，请求出错时为0
+	Err        error         // 请求错误
+	Elapsed    time.Duration // 本次尝试耗时
+	Delay      time.Duration // 本次尝试后等待重试的时间
+}
+
+// 一次请求的连接与耗时记录，复用连接时DNS、连接与握手的耗时为0
+type Trace struct {
+	Start              time.Time     // 开始获取连接的时间
+	GetConn            time.Duration // 获取连接的总耗时，包含DNS解析、建立连接、TLS握手或等待空闲连接
+	DNSLookup          time.Duration // DNS解析耗时，使用IP或由代理解析时为0
+	Addrs              []string      // DNS解析得到的地址
+	Connect            time.Duration // 建立TCP连接的耗时，使用代理时包含建立隧道的时间
+	TLSHandshake       time.Duration // TLS握手耗时
+	TLSVersion         string        // 协商的TLS版本，如"TLS 1.3"
+	CipherSuite        string        // 协商的密码套件，如"TLS_AES_128_GCM_SHA256"
+	NegotiatedProtocol string        // ALPN协商结果，如"h2"
+	DidResume          bool          // 是否通过会话恢复完成握手
+	Reused             bool          // 是否复用了已有的连接
+	WasIdle            bool          // 复用的连接是否来自空闲连接池
+	IdleTime           time.Duration // 复用的连接空闲的时长
+	RemoteAddr         string        // 对端地址，使用代理时为代理地址
+	TimeToFirstByte    time.Duration // 从开始获取连接到收到响应首字节的耗时
+	BodyRead           time.Duration // 读取响应体的耗时，流式响应为0
+}
+
 // Response结构体
 type Response struct {
-	Url        string
-	Headers    http.Header
-	Cookies    []*http.Cookie
-	Text       string
-	Content    []byte
-	Body       io.ReadCloser
-	StatusCode int
-	History    []*Response
-	Request    *url.Request
+	Url           string
+	Headers       http.Header
+	Cookies       []*http.Cookie
+	Text          string
+	Content       []byte
+	Body          io.ReadCloser
+	StatusCode    int
+	History       []*Response
+	Request       *url.Request
+	Stream        bool                  // 为true时Body为未读取的响应流，Content与Text在Load后填充
+	Attempts      []*Attempt            // 每次请求尝试的记录，未重试时只有一条
+	Proxy         string                // 本次请求使用的代理，未使用代理时为空
+	Elapsed       time.Duration         // 从发送请求到读取完响应体的耗时，包含重定向，流式响应只计算到收到响应头
+	Trace         *Trace                // 最后一次请求的连接与耗时记录，History中的响应记录各自的请求
+	Proto         string                // 响应的协议版本，如"HTTP/1.1"、"HTTP/2.0"
+	TLS           *utls.ConnectionState // 协商的TLS连接状态，包含服务器证书链与OCSP响应，明文请求为nil
+	Encoding      string                // Text使用的编码，如"utf-8"、"gbk"，非文本响应为空，可用SetEncoding修改后重新解码
+	EncodingError error                 // 按Encoding解码失败的错误，此时Text按UTF-8解码，无效字节替换为U+FFFD
+	loaded        bool
+}
+
+// 读取流式响应的剩余内容并填充Content与Text，已设置Encoding时按该编码解码，非流式响应不做处理
+func (res *Response) Load() error {
+	if !res.Stream || res.loaded {
+		return nil
+	}
+	defer res.Body.Close()
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	res.Content = content
+	if res.Encoding == "" {
+		res.Encoding = DetectEncoding(content, res.Headers.Get("Content-Type"))
+	}
+	res.DecodeContent()
+	res.Body = ioutil.NopCloser(bytes.NewReader(content))
+	res.loaded = true
+	return nil
+}
+
+// 按块迭代响应内容，流式响应边读边返回，每块最多chunkSize字节
+func (res *Response) IterContent(chunkSize int) iter.Seq2[[]byte, error] {
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+	return func(yield func([]byte, error) bool) {
+		if !res.Stream || res.loaded {
+			for start := 0; start < len(res.Content); start += chunkSize {
+				if !yield(res.Content[start:min(start+chunkSize, len(res.Content))], nil) {
+					return
+				}
+			}
+			return
+		}
+		defer res.Body.Close()
+		buf := make([]byte, chunkSize)
+		for {
+			n, err := res.Body.Read(buf)
+			if n > 0 {
+				if !yield(append([]byte(nil), buf[:n]...), nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// 按行迭代响应内容，返回的行不包含换行符
+func (res *Response) IterLines() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var r io.Reader
+		if !res.Stream || res.loaded {
+			r = bytes.NewReader(res.Content)
+		} else {
+			defer res.Body.Close()
+			r = res.Body
+		}
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if len(line) > 0 {
+				if !yield(strings.TrimRight(line, "\r\n"), nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield("", err)
+				return
+			}
+		}
+	}
 }
 
 // 使用自带库JSON解析
 func (res *Response) Json() (map[string]interface{}, error) {
+	if err := res.Load(); err != nil {
+		return nil, err
+	}
 	js := make(map[string]interface{})
 	err := json.Unmarshal(res.Content, &js)
 	return js, err
 }
 
-// 使用go-simplejson解析
+// 使用go-simplejson解析，与Json相同读取Content，可重复调用
 func (res *Response) SimpleJson() (*simplejson.Json, error) {
-	return simplejson.NewFromReader(res.Body)
+	if err := res.Load(); err != nil {
+		return nil, err
+	}
+	return simplejson.NewFromReader(bytes.NewReader(res.Content))
 }
 
 // 状态码是否合格
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 统计检测时读取的最大字节数
+const detectSampleSize = 32 << 10
+
+// HTML中<meta charset>与<meta http-equiv>声明的编码，按HTML规范只在前1024字节中查找
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([\w.:-]+)`)
+
+// 常用汉字（简体与繁体），用于区分GB18030与Big5，来源见data/common_han.txt
+//
+//go:embed data/common_han.txt
+var commonHanData string
+
+var commonHan = loadCommonHan(commonHanData)
+
+// 去掉注释行与换行，返回全部汉字
+func loadCommonHan(data string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// 统计检测的候选编码
+var detectCandidates = []string{"gb18030", "big5", "shift_jis", "euc-kr"}
+
+// 检测响应内容的编码，依次使用BOM、Content-Type的charset、HTML的<meta>声明，最后按内容统计检测，
+// 非文本类型的响应返回空字符串
+func DetectEncoding(content []byte, contentType string) string {
+	if _, name, certain := charset.DetermineEncoding(content, contentType); certain {
+		return name
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isTextType(mediaType) {
+		return ""
+	}
+	head := content[:min(len(content), 1024)]
+	if m := metaCharset.FindSubmatch(head); m != nil {
+		if _, name := charset.Lookup(string(m[1])); name != "" {
+			return name
+		}
+	}
+	// JSON按RFC 8259使用UTF-8
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return "utf-8"
+	}
+	return detectCharset(content)
+}
+
+// 是否为文本类型，未设置Content-Type时按文本处理
+func isTextType(mediaType string) bool {
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, s := range []string{"html", "xml", "json", "javascript", "ecmascript", "x-www-form-urlencoded", "csv"} {
+		if strings.Contains(mediaType, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按内容统计检测编码，合法的UTF-8优先，否则选择解码后常用字最多、无效字节最少的编码
+func detectCharset(content []byte) string {
+	sample := content[:min(len(content), detectSampleSize)]
+	// 去掉截断时不完整的UTF-8字符
+	for i := len(sample) - 1; i >= 0 && i > len(sample)-4; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8"
+	}
+	best, bestScore := "windows-1252", 0
+	for _, name := range detectCandidates {
+		encoding, _ := charset.Lookup(name)
+		text, err := encoding.NewDecoder().Bytes(sample)
+		if err != nil {
+			continue
+		}
+		// 每个可识别的字符（常用汉字、全角假名、谚文）加2分，每个无法解码的字符减10分：
+		// 错误的编码解码出的乱码多为生僻字并夹杂无效字节，一个无效字节抵消5个常用字，
+		// 得分需大于0才能取代windows-1252
+		score := 0
+		for _, r := range string(text) {
+			switch {
+			case r == utf8.RuneError:
+				score -= 10
+			case name == "shift_jis" && unicode.In(r, unicode.Hiragana, unicode.Katakana) && !isHalfwidthKana(r):
+				score += 2
+			case name == "euc-kr" && unicode.Is(unicode.Hangul, r):
+				score += 2
+			case unicode.Is(unicode.Han, r) && strings.ContainsRune(commonHan, r):
+				score += 2
+			}
+		}
+		if score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best
+}
+
+// 半角片假名，其他编码的双字节内容按Shift_JIS解码时多为半角片假名，不作为日文的依据
+func isHalfwidthKana(r rune) bool {
+	return r >= 0xFF61 && r <= 0xFF9F
+}
+
+// 将内容按编码解码为UTF-8文本，编码为空或为utf-8时不转换，开头的BOM会被去掉
+func DecodeText(content []byte, encoding string) (string, error) {
+	if encoding == "" || strings.EqualFold(encoding, "utf-8") || strings.EqualFold(encoding, "utf8") {
+		return string(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))), nil
+	}
+	e, _ := charset.Lookup(encoding)
+	if e == nil {
+		return "", fmt.Errorf("unknown encoding %q", encoding)
+	}
+	text, err := e.NewDecoder().Bytes(content)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(string(text), "\uFEFF"), nil
+}
+
+// 修改Text使用的编码并按新编码重新解码Content，与Python requests中设置r.encoding相同
+func (res *Response) SetEncoding(encoding string) error {
+	text, err := DecodeText(res.Content, encoding)
+	if err != nil {
+		return err
+	}
+	res.Encoding = encoding
+	res.Text = text
+	res.EncodingError = nil
+	return nil
+}
+
+// 按Encoding解码Content填充Text，失败时按UTF-8解码并将无效字节替换为U+FFFD，错误记录到EncodingError
+func (res *Response) DecodeContent() {
+	text, err := DecodeText(res.Content, res.Encoding)
+	if err != nil {
+		text = strings.ToValidUTF8(string(bytes.TrimPrefix(res.Content, []byte("\xef\xbb\xbf"))), "\uFFFD")
+	}
+	res.Text, res.EncodingError = text, err
+}
@@ -0,0 +1,218 @@
+package profiles
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	http "github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/*.json
+var data embed.FS
+
+var (
+	mutex    = &sync.RWMutex{}
+	registry = map[string]*Profile{}
+)
+
+func init() {
+	entries, err := data.ReadDir("data")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		content, err := data.ReadFile(path.Join("data", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if err = Load(content); err != nil {
+			panic(fmt.Errorf("profiles: %s: %w", entry.Name(), err))
+		}
+	}
+}
+
+// 浏览器指纹模板，包含TLS指纹、HTTP2指纹、请求头及其顺序
+type Profile struct {
+	Name              string                `json:"Name"`     // 模板名称，如chrome_133
+	Browser           string                `json:"Browser"`  // 浏览器，如chrome、firefox、safari、edge
+	Version           string                `json:"Version"`  // 浏览器主版本号
+	Platform          string                `json:"Platform"` // 平台，如windows、macos、android、ios
+	Mobile            bool                  `json:"Mobile"`
+	JA3               string                `json:"JA3"`
+	UserAgent         string                `json:"UserAgent"`
+	TLSExtensions     *transport.Extensions `json:"TLSExtensions"`
+	HTTP2Settings     *transport.H2Settings `json:"HTTP2Settings"`
+	PseudoHeaderOrder []string              `json:"PseudoHeaderOrder"`
+	Headers           map[string]string     `json:"Headers"`     // 默认请求头，不含User-Agent
+	HeaderOrder       []string              `json:"HeaderOrder"` // 请求头顺序
+
+	once          sync.Once
+	tlsExtensions *http.TLSExtensions
+	extra         *transport.ExtraExtensions
+	http2Settings *http.HTTP2Settings
+	err           error
+}
+
+// 转换为TLS扩展，结果会被缓存，相同模板的请求共享同一个Transport
+func (p *Profile) ToTLSExtensions() *http.TLSExtensions {
+	p.convert()
+	return p.tlsExtensions
+}
+
+// 转换TLS扩展中的额外设置，没有设置时返回nil，结果会被缓存
+func (p *Profile) ToExtraExtensions() *transport.ExtraExtensions {
+	p.convert()
+	return p.extra
+}
+
+// 转换为HTTP2指纹设置，结果会被缓存
+func (p *Profile) ToHTTP2Settings() *http.HTTP2Settings {
+	p.convert()
+	return p.http2Settings
+}
+
+// 转换TLS扩展与HTTP2指纹设置，只执行一次，注册时已校验
+func (p *Profile) convert() error {
+	p.once.Do(func() {
+		if p.TLSExtensions != nil {
+			if p.tlsExtensions, p.err = transport.ToTLSExtensions(p.TLSExtensions); p.err != nil {
+				return
+			}
+			if p.extra, p.err = transport.ToExtraExtensions(p.TLSExtensions); p.err != nil {
+				return
+			}
+		}
+		if p.HTTP2Settings != nil {
+			p.http2Settings, p.err = transport.ToHTTP2Settings(p.HTTP2Settings)
+		}
+	})
+	return p.err
+}
+
+// 生成模板的请求头，包含User-Agent及请求头顺序
+func (p *Profile) Header() *http.Header {
+	headers := url.NewHeaders()
+	for key, value := range p.Headers {
+		headers.Set(key, value)
+	}
+	if p.UserAgent != "" {
+		headers.Set("User-Agent", p.UserAgent)
+	}
+	if p.HeaderOrder != nil {
+		(*headers)[http.HeaderOrderKey] = append([]string(nil), p.HeaderOrder...)
+	}
+	if len(p.PseudoHeaderOrder) == 4 {
+		(*headers)[http.PHeaderOrderKey] = append([]string(nil), p.PseudoHeaderOrder...)
+	}
+	return headers
+}
+
+// 将模板应用到单个请求，请求中已设置的请求头及请求头顺序优先，伪头部顺序使用模板的设置
+func (p *Profile) ApplyRequest(req *url.Request) {
+	req.Ja3, req.Ja4 = p.JA3, ""
+	req.TLSExtensions = p.ToTLSExtensions()
+	req.ExtraExtensions = p.ToExtraExtensions()
+	req.HTTP2Settings = p.ToHTTP2Settings()
+	headers := p.Header()
+	if req.Headers != nil {
+		for key, values := range *req.Headers {
+			if key == http.PHeaderOrderKey || (key == http.HeaderOrderKey && len(values) == 0) {
+				continue
+			}
+			(*headers)[key] = values
+		}
+	}
+	req.Headers = headers
+}
+
+// 校验模板
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return errors.New("profile name is empty")
+	}
+	if len(strings.Split(p.JA3, ",")) != 5 {
+		return fmt.Errorf("profile %s: invalid JA3 string %q", p.Name, p.JA3)
+	}
+	if p.PseudoHeaderOrder != nil && len(p.PseudoHeaderOrder) != 4 {
+		return fmt.Errorf("profile %s: PseudoHeaderOrder requires 4 pseudo headers", p.Name)
+	}
+	if err := p.convert(); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// 获取指定名称的模板，名称不区分大小写
+func Get(name string) (*Profile, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if p, ok := registry[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("profile %q not found", name)
+}
+
+// 所有已注册模板的名称
+func Names() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 注册模板，同名模板会被覆盖
+func Register(p *Profile) error {
+	if p == nil {
+		return errors.New("profile is nil")
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	registry[strings.ToLower(p.Name)] = p
+	return nil
+}
+
+// 从JSON中加载模板，支持单个模板或模板数组
+func Load(content []byte) error {
+	var profiles []*Profile
+	if strings.HasPrefix(strings.TrimSpace(string(content)), "[") {
+		if err := json.Unmarshal(content, &profiles); err != nil {
+			return err
+		}
+	} else {
+		p := &Profile{}
+		if err := json.Unmarshal(content, p); err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+	for _, p := range profiles {
+		if err := Register(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从JSON文件中加载模板
+func LoadFile(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return Load(content)
+}
@@ -0,0 +1,280 @@
+package requests_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/wangluozhe/requests"
+	"github.com/wangluozhe/requests/fingerprint/echoserver"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 测试用的代理服务器，记录客户端请求的目标地址与认证信息，隧道统一转发到target
+type testProxy struct {
+	URL    string
+	target string
+	serve  func(conn net.Conn) (addr, user string, err error)
+
+	mutex sync.Mutex
+	addrs []string
+	users []string
+}
+
+func newTestProxy(t *testing.T, scheme, target string, serve func(net.Conn) (string, string, error)) *testProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	p := &testProxy{URL: scheme + "://" + ln.Addr().String(), target: target, serve: serve}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.handle(conn)
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	addr, user, err := p.serve(conn)
+	if err != nil {
+		return
+	}
+	p.mutex.Lock()
+	p.addrs = append(p.addrs, addr)
+	p.users = append(p.users, user)
+	p.mutex.Unlock()
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (p *testProxy) requests() ([]string, []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]string(nil), p.addrs...), append([]string(nil), p.users...)
+}
+
+// HTTP CONNECT代理
+func serveConnect(conn net.Conn) (string, string, error) {
+	req, err := nethttp.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return "", "", err
+	}
+	if req.Method != nethttp.MethodConnect {
+		io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return "", "", errors.New("not a CONNECT request")
+	}
+	// 复用ReadRequest对Authorization的解析
+	req.Header.Set("Authorization", req.Header.Get("Proxy-Authorization"))
+	user, _, _ := req.BasicAuth()
+	_, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, user, err
+}
+
+// SOCKS4与SOCKS4a代理
+func serveSOCKS4(conn net.Conn) (string, string, error) {
+	r := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", "", err
+	}
+	if header[0] != 4 || header[1] != 1 {
+		return "", "", errors.New("not a SOCKS4 CONNECT request")
+	}
+	user, err := r.ReadString(0)
+	if err != nil {
+		return "", "", err
+	}
+	host := net.IP(header[4:8]).String()
+	if header[4] == 0 && header[5] == 0 && header[6] == 0 && header[7] != 0 {
+		if host, err = r.ReadString(0); err != nil {
+			return "", "", err
+		}
+		host = host[:len(host)-1]
+	}
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(header[2:4])))
+	_, err = conn.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, port), user[:len(user)-1], err
+}
+
+// SOCKS5代理，支持无认证与用户名密码认证
+func serveSOCKS5(conn net.Conn) (string, string, error) {
+	r := bufio.NewReader(conn)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil || header[0] != 5 {
+		return "", "", errors.New("not a SOCKS5 handshake")
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", "", err
+	}
+	method := byte(0)
+	for _, m := range methods {
+		if m == 2 {
+			method = 2
+		}
+	}
+	if _, err := conn.Write([]byte{5, method}); err != nil {
+		return "", "", err
+	}
+	var user string
+	if method == 2 {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return "", "", err
+		}
+		name := make([]byte, header[1])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", "", err
+		}
+		size, err := r.ReadByte()
+		if err != nil {
+			return "", "", err
+		}
+		if _, err = io.ReadFull(r, make([]byte, size)); err != nil {
+			return "", "", err
+		}
+		if _, err = conn.Write([]byte{1, 0}); err != nil {
+			return "", "", err
+		}
+		user = string(name)
+	}
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil {
+		return "", "", err
+	}
+	var host string
+	switch request[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if request[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		size, err := r.ReadByte()
+		if err != nil {
+			return "", "", err
+		}
+		name := make([]byte, size)
+		if _, err = io.ReadFull(r, name); err != nil {
+			return "", "", err
+		}
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", "", err
+	}
+	_, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), user, err
+}
+
+// 请求回显服务器并返回报告
+func echoReport(t *testing.T, server *echoserver.Server, proxies string) *echoserver.Report {
+	session := requests.NewSession()
+	defer session.Close()
+	if err := session.ApplyProfile("firefox_128"); err != nil {
+		t.Fatal(err)
+	}
+	session.TLSConfig = &url.TLSConfig{RootCAs: server.CertificatePEM}
+	req := url.NewRequest()
+	req.Proxies = proxies
+	r, err := session.Get(server.URL+"/api/all", req)
+	if err != nil {
+		t.Fatalf("proxy %q: %v", proxies, err)
+	}
+	report := &echoserver.Report{}
+	if err = json.Unmarshal(r.Content, report); err != nil {
+		t.Fatal(err)
+	}
+	if report.HTTP2 == nil {
+		t.Fatalf("proxy %q: expected an HTTP2 report", proxies)
+	}
+	return report
+}
+
+// 经过各类代理建立隧道后，TLS与HTTP2指纹与直连时相同
+func TestProxyFingerprint(t *testing.T) {
+	server, err := echoserver.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Addr)
+	direct := echoReport(t, server, "")
+
+	tests := []struct {
+		scheme string
+		serve  func(net.Conn) (string, string, error)
+		user   string
+		local  bool // 是否在本地解析域名
+	}{
+		{scheme: "http", serve: serveConnect},
+		{scheme: "http", serve: serveConnect, user: "alice"},
+		{scheme: "socks4", serve: serveSOCKS4, user: "alice", local: true},
+		{scheme: "socks4a", serve: serveSOCKS4},
+		{scheme: "socks5", serve: serveSOCKS5, local: true},
+		{scheme: "socks5h", serve: serveSOCKS5, user: "alice"},
+	}
+	for _, test := range tests {
+		proxy := newTestProxy(t, test.scheme, server.Addr, test.serve)
+		proxies := proxy.URL
+		if test.user != "" {
+			proxies = test.scheme + "://" + test.user + ":secret@" + proxy.URL[len(test.scheme)+3:]
+		}
+		report := echoReport(t, server, proxies)
+		if report.TLS.JA3 != direct.TLS.JA3 || report.TLS.JA4 != direct.TLS.JA4 {
+			t.Errorf("%s: TLS fingerprint changed: %s %s, direct %s %s", proxies, report.TLS.JA3, report.TLS.JA4, direct.TLS.JA3, direct.TLS.JA4)
+		}
+		if report.HTTP2.AkamaiFingerprint != direct.HTTP2.AkamaiFingerprint {
+			t.Errorf("%s: Akamai = %s, direct %s", proxies, report.HTTP2.AkamaiFingerprint, direct.HTTP2.AkamaiFingerprint)
+		}
+		addrs, users := proxy.requests()
+		if len(addrs) != 1 {
+			t.Fatalf("%s: proxy received %d tunnels, want 1", proxies, len(addrs))
+		}
+		host, p, _ := net.SplitHostPort(addrs[0])
+		if p != port || (net.ParseIP(host) != nil) != test.local || (!test.local && host != "localhost") {
+			t.Errorf("%s: tunnel target = %s", proxies, addrs[0])
+		}
+		if users[0] != test.user {
+			t.Errorf("%s: proxy user = %q, want %q", proxies, users[0], test.user)
+		}
+	}
+}
+
+// SOCKS4代理拒绝连接时返回错误
+func TestSOCKS4Rejected(t *testing.T) {
+	proxy := newTestProxy(t, "socks4a", "127.0.0.1:1", func(conn net.Conn) (string, string, error) {
+		io.ReadFull(conn, make([]byte, 8))
+		conn.Write([]byte{0, 91, 0, 0, 0, 0, 0, 0})
+		return "", "", errors.New("rejected")
+	})
+	req := url.NewRequest()
+	req.Proxies = proxy.URL
+	_, err := requests.NewSession().Get("https://localhost/", req)
+	if err == nil || !strings.Contains(err.Error(), "socks4 connect failed: code 91") {
+		t.Fatalf("err = %v, want socks4 rejection", err)
+	}
+}
@@ -0,0 +1,52 @@
+package requests
+
+import (
+	"github.com/wangluozhe/requests/url"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 代理被移出代理池后释放对应的Transport
+func TestProxyPoolRemovedProxyReleasesTransport(t *testing.T) {
+	var proxies []string
+	for i := 0; i < 2; i++ {
+		// 作为http代理转发明文请求，直接返回代理地址
+		proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.Write([]byte(r.Host))
+		}))
+		defer proxy.Close()
+		proxies = append(proxies, proxy.URL)
+	}
+	session := NewSession()
+	defer session.Close()
+	session.ProxyPool = url.NewProxyPool(proxies...)
+	for i := 0; i < 2; i++ {
+		r, err := session.Get("http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Proxy != proxies[i] {
+			t.Fatalf("proxy = %s, want %s", r.Proxy, proxies[i])
+		}
+	}
+	if n := transportCount(session); n != 2 {
+		t.Fatalf("transports = %d, want 2", n)
+	}
+	before := session.Stats().Open
+
+	session.ProxyPool.Remove(proxies[0])
+	session.mutex.Lock()
+	session.transports.swept = time.Time{}
+	session.mutex.Unlock()
+	if _, err := session.Get("http://example.com/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := transportCount(session); n != 1 {
+		t.Fatalf("transports = %d, want 1", n)
+	}
+	if after := session.Stats().Open; after >= before {
+		t.Fatalf("open connections = %d, want fewer than %d", after, before)
+	}
+}
@@ -0,0 +1,155 @@
+package requests
+
+import (
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/url"
+	url2 "net/url"
+	"strings"
+)
+
+// 跨源重定向时默认删除的请求头
+var sensitiveHeaders = []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"}
+
+// 合并Session与请求中的重定向策略，请求中的Redirect整体替换Session的设置
+func (s *Session) redirect(req *url.Request) url.Redirect {
+	policy := url.Redirect{}
+	if req.Redirect != nil {
+		policy = *req.Redirect
+	} else if s.Redirect != nil {
+		policy = *s.Redirect
+	}
+	if policy.MaxRedirects <= 0 {
+		policy.MaxRedirects = s.MaxRedirects
+	}
+	return policy
+}
+
+// 按重定向策略发送请求，返回最终的响应与经过的重定向响应，重定向响应的响应体会被读取并关闭
+func (s *Session) do(client *http.Client, request *http.Request, preq *models.PrepareRequest, req *url.Request, recorder *traceRecorder) (*http.Response, []*models.Response, error) {
+	r := &redirector{
+		policy:  s.redirect(req),
+		initial: request.URL,
+		header:  request.Header.Clone(), // 不含Jar添加的Cookie
+	}
+	var history []*models.Response
+	for {
+		resp, err := client.Do(request)
+		if err != nil || !req.AllowRedirects {
+			return resp, history, err
+		}
+		next, err := r.next(request, resp)
+		if err == nil && next != nil && len(history) >= r.policy.MaxRedirects {
+			err = fmt.Errorf("%w: stopped after %d redirects", url.ErrTooManyRedirects, r.policy.MaxRedirects)
+		}
+		if err != nil {
+			resp.Body.Close()
+			return nil, history, err
+		}
+		if next == nil {
+			return resp, history, nil
+		}
+
+		// 每个重定向响应记录各自的请求地址、请求头与连接信息
+		sent := *req
+		sent.Headers = &request.Header
+		sent.Stream = false
+		response, err := s.buildResponse(resp, &models.PrepareRequest{Method: request.Method, Url: request.URL.String()}, &sent)
+		if err != nil {
+			return nil, history, err
+		}
+		response.Trace = recorder.snapshot()
+		history = append(history, response)
+
+		// Session中目标地址的Cookies交给Jar在下一个请求中发送
+		if s.Cookies != nil {
+			merge_cookies(next.URL.String(), preq.Cookies, s.Cookies)
+		}
+		request = next
+	}
+}
+
+// 跟随一次请求的重定向
+type redirector struct {
+	policy  url.Redirect
+	initial *url2.URL
+	header  http.Header // 首个请求的请求头，改写为GET后删除请求体相关的请求头
+}
+
+// 根据重定向响应构建下一个请求，返回nil时不再跟随，将该响应作为最终响应
+func (r *redirector) next(prev *http.Request, resp *http.Response) (*http.Request, error) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	u, err := prev.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Location header %q: %v", location, err)
+	}
+	if r.policy.SameHostOnly && !strings.EqualFold(u.Hostname(), r.initial.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", url.ErrRedirectHost, u)
+	}
+	downgrade := prev.URL.Scheme == "https" && u.Scheme == "http"
+	if r.policy.ForbidDowngrade && downgrade {
+		return nil, fmt.Errorf("%w: %s", url.ErrRedirectDowngrade, u)
+	}
+
+	next, err := http.NewRequestWithContext(prev.Context(), r.policy.Method(resp.StatusCode, prev.Method), u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if next.Method != prev.Method || prev.GetBody == nil && prev.Body != nil && prev.Body != http.NoBody {
+		if next.Method == prev.Method {
+			// 请求体无法重新发送，返回重定向响应
+			return nil, nil
+		}
+		for _, key := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			r.header.Del(key)
+		}
+	} else if prev.GetBody != nil {
+		if next.Body, err = prev.GetBody(); err != nil {
+			return nil, err
+		}
+		next.GetBody, next.ContentLength = prev.GetBody, prev.ContentLength
+	}
+
+	next.Header = r.header.Clone()
+	if !r.policy.KeepSensitiveHeaders && !sameOrigin(r.initial, u) {
+		for _, key := range sensitiveHeaders {
+			next.Header.Del(key)
+		}
+	}
+	if !r.policy.Referer {
+		return next, nil
+	}
+	// 与浏览器相同，Referer为上一个请求的地址，https重定向到http时不发送
+	if referer := r.header.Get("Referer"); downgrade {
+		next.Header.Del("Referer")
+	} else if referer == "" {
+		ref := *prev.URL
+		ref.User = nil
+		next.Header.Set("Referer", ref.String())
+	}
+	return next, nil
+}
+
+// 协议、主机与端口都相同时为同源
+func sameOrigin(a, b *url2.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && originPort(a) == originPort(b)
+}
+
+func originPort(u *url2.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
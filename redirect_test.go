@@ -0,0 +1,278 @@
+package requests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 服务器收到的请求
+type receivedRequest struct {
+	method string
+	path   string
+	body   string
+	header nethttp.Header
+}
+
+// /hop/N重定向到/hop/N-1，/to?code=&url=按code重定向到url，其他路径返回ok，记录收到的每个请求
+type redirectServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	received []receivedRequest
+}
+
+func newRedirectServer(t *testing.T, tls bool) *redirectServer {
+	s := &redirectServer{}
+	handler := nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mutex.Lock()
+		s.received = append(s.received, receivedRequest{method: r.Method, path: r.URL.Path, body: string(body), header: r.Header.Clone()})
+		s.mutex.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+			if n > 0 {
+				nethttp.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), nethttp.StatusFound)
+				return
+			}
+		case r.URL.Path == "/to":
+			code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+			if code == 0 {
+				code = nethttp.StatusFound
+			}
+			w.Header().Set("Location", r.URL.Query().Get("url"))
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	if tls {
+		s.Server = httptest.NewTLSServer(handler)
+	} else {
+		s.Server = httptest.NewServer(handler)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// 重定向到target的地址
+func (s *redirectServer) to(target string, code int) string {
+	return fmt.Sprintf("%s/to?code=%d&url=%s", s.URL, code, url2.QueryEscape(target))
+}
+
+// 最后收到的请求
+func (s *redirectServer) last() receivedRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received[len(s.received)-1]
+}
+
+func TestRedirectHistory(t *testing.T) {
+	server := newRedirectServer(t, false)
+	r, err := NewSession().Get(server.URL+"/hop/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 200 || r.Text != "ok" || r.Url != server.URL+"/hop/0" {
+		t.Fatalf("final response: status = %d, url = %s, text = %q", r.StatusCode, r.Url, r.Text)
+	}
+	if len(r.History) != 2 {
+		t.Fatalf("got %d history responses, want 2", len(r.History))
+	}
+	for i, want := range []string{"/hop/2", "/hop/1"} {
+		h := r.History[i]
+		if h.StatusCode != nethttp.StatusFound || h.Url != server.URL+want || h.Headers.Get("Location") != fmt.Sprintf("/hop/%d", 1-i) {
+			t.Errorf("history %d: status = %d, url = %s, location = %s", i, h.StatusCode, h.Url, h.Headers.Get("Location"))
+		}
+	}
+
+	req := url.NewRequest()
+	req.AllowRedirects = false
+	if r, err = NewSession().Get(server.URL+"/hop/2", req); err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != nethttp.StatusFound || len(r.History) != 0 {
+		t.Fatalf("AllowRedirects false: status = %d, history = %d", r.StatusCode, len(r.History))
+	}
+}
+
+// 策略中的MaxRedirects为0时使用Session.MaxRedirects
+func TestRedirectMaxRedirects(t *testing.T) {
+	server := newRedirectServer(t, false)
+	session := NewSession()
+	session.MaxRedirects = 2
+	session.Redirect = &url.Redirect{}
+	if _, err := session.Get(server.URL+"/hop/2", nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := session.Get(server.URL+"/hop/3", nil)
+	if !errors.Is(err, url.ErrTooManyRedirects) {
+		t.Fatalf("err = %v, want ErrTooManyRedirects", err)
+	}
+
+	req := url.NewRequest()
+	req.Redirect = &url.Redirect{MaxRedirects: 3}
+	if _, err = session.Get(server.URL+"/hop/3", req); err != nil {
+		t.Fatal(err)
+	}
+	req.Redirect.MaxRedirects = 1
+	if _, err = session.Get(server.URL+"/hop/2", req); !errors.Is(err, url.ErrTooManyRedirects) {
+		t.Fatalf("err = %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestRedirectSameHostOnly(t *testing.T) {
+	server := newRedirectServer(t, false)
+	other := newRedirectServer(t, false)
+	req := url.NewRequest()
+	req.Redirect = &url.Redirect{SameHostOnly: true}
+	_, err := NewSession().Get(server.to("http://other.invalid/", 302), req)
+	if !errors.Is(err, url.ErrRedirectHost) {
+		t.Fatalf("err = %v, want ErrRedirectHost", err)
+	}
+	// 端口不同的相同主机允许重定向
+	r, err := NewSession().Get(server.to(other.URL+"/hop/0", 302), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Url != other.URL+"/hop/0" {
+		t.Fatalf("url = %s", r.Url)
+	}
+}
+
+func TestRedirectForbidDowngrade(t *testing.T) {
+	secure := newRedirectServer(t, true)
+	plain := newRedirectServer(t, false)
+	req := url.NewRequest()
+	req.InsecureSkipVerify = true
+	req.Redirect = url.NewRedirect()
+	req.Redirect.Referer = true
+	_, err := NewSession().Get(secure.to(plain.URL+"/hop/0", 302), req)
+	if !errors.Is(err, url.ErrRedirectDowngrade) {
+		t.Fatalf("err = %v, want ErrRedirectDowngrade", err)
+	}
+
+	req.Redirect.ForbidDowngrade = false
+	r, err := NewSession().Get(secure.to(plain.URL+"/hop/0", 302), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Url != plain.URL+"/hop/0" {
+		t.Fatalf("url = %s", r.Url)
+	}
+	// https重定向到http时不发送Referer
+	if referer := plain.last().header.Get("Referer"); referer != "" {
+		t.Fatalf("downgrade sent Referer %q", referer)
+	}
+}
+
+// 跨源重定向时删除Authorization与Cookie，KeepSensitiveHeaders为true时保留
+func TestRedirectSensitiveHeaders(t *testing.T) {
+	server := newRedirectServer(t, false)
+	other := newRedirectServer(t, false)
+	tests := []struct {
+		name string
+		url  string
+		keep bool
+		last func() receivedRequest
+		want bool
+	}{
+		{name: "same origin", url: server.to("/hop/0", 302), last: server.last, want: true},
+		{name: "cross origin", url: server.to(other.URL+"/hop/0", 302), last: other.last, want: false},
+		{name: "keep", url: server.to(other.URL+"/hop/0", 302), keep: true, last: other.last, want: true},
+	}
+	for _, test := range tests {
+		req := url.NewRequest()
+		req.Headers = url.NewHeaders()
+		req.Headers.Set("Authorization", "Bearer token")
+		req.Headers.Set("Cookie", "sid=1")
+		req.Headers.Set("X-Custom", "1")
+		req.Redirect = &url.Redirect{KeepSensitiveHeaders: test.keep}
+		if _, err := NewSession().Get(test.url, req); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		header := test.last().header
+		if got := header.Get("Authorization") != "" && header.Get("Cookie") != ""; got != test.want {
+			t.Errorf("%s: Authorization = %q, Cookie = %q", test.name, header.Get("Authorization"), header.Get("Cookie"))
+		}
+		if header.Get("X-Custom") != "1" {
+			t.Errorf("%s: X-Custom was not forwarded", test.name)
+		}
+	}
+}
+
+// 301、302、303按Rewrite改写请求方法，307、308保持原请求方法与请求体
+func TestRedirectRewrite(t *testing.T) {
+	server := newRedirectServer(t, false)
+	tests := []struct {
+		method  string
+		code    int
+		rewrite url.RedirectRewrite
+		want    string
+	}{
+		{method: "POST", code: 301, rewrite: url.RewriteBrowser, want: "GET"},
+		{method: "POST", code: 302, rewrite: url.RewriteBrowser, want: "GET"},
+		{method: "PUT", code: 302, rewrite: url.RewriteBrowser, want: "PUT"},
+		{method: "PUT", code: 303, rewrite: url.RewriteBrowser, want: "GET"},
+		{method: "PUT", code: 301, rewrite: url.RewriteAlways, want: "GET"},
+		{method: "POST", code: 303, rewrite: url.RewriteNever, want: "POST"},
+		{method: "POST", code: 307, rewrite: url.RewriteAlways, want: "POST"},
+		{method: "PUT", code: 308, rewrite: url.RewriteBrowser, want: "PUT"},
+	}
+	for _, test := range tests {
+		req := url.NewRequest()
+		req.Body = strings.NewReader("payload")
+		req.Redirect = &url.Redirect{Rewrite: test.rewrite}
+		if _, err := NewSession().Request(test.method, server.to("/hop/0", test.code), req); err != nil {
+			t.Fatalf("%s %d: %v", test.method, test.code, err)
+		}
+		last := server.last()
+		wantBody := ""
+		if test.want == test.method {
+			wantBody = "payload"
+		}
+		if last.method != test.want || last.body != wantBody || last.path != "/hop/0" {
+			t.Errorf("%s %d rewrite %d: got %s %s body %q, want %s body %q", test.method, test.code, test.rewrite, last.method, last.path, last.body, test.want, wantBody)
+		}
+		if wantBody == "" && last.header.Get("Content-Type") != "" {
+			t.Errorf("%s %d rewrite %d: Content-Type %q was forwarded without a body", test.method, test.code, test.rewrite, last.header.Get("Content-Type"))
+		}
+	}
+}
+
+// 只有策略中的Referer为true时设置Referer，请求中显式设置的Referer保持不变
+func TestRedirectReferer(t *testing.T) {
+	server := newRedirectServer(t, false)
+	if _, err := NewSession().Get(server.URL+"/hop/1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if referer := server.last().header.Get("Referer"); referer != "" {
+		t.Fatalf("default policy sent Referer %q", referer)
+	}
+
+	req := url.NewRequest()
+	req.Redirect = &url.Redirect{Referer: true}
+	if _, err := NewSession().Get(server.URL+"/hop/2", req); err != nil {
+		t.Fatal(err)
+	}
+	if referer := server.last().header.Get("Referer"); referer != server.URL+"/hop/1" {
+		t.Fatalf("Referer = %q, want %s", referer, server.URL+"/hop/1")
+	}
+
+	req.Headers = url.NewHeaders()
+	req.Headers.Set("Referer", "https://example.com/")
+	if _, err := NewSession().Get(server.URL+"/hop/2", req); err != nil {
+		t.Fatal(err)
+	}
+	if referer := server.last().header.Get("Referer"); referer != "https://example.com/" {
+		t.Fatalf("Referer = %q, want the request's Referer", referer)
+	}
+}
@@ -0,0 +1,297 @@
+package requests
+
+import (
+	"errors"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/url"
+	"golang.org/x/net/html/charset"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// SimpleJson与Json一样读取Content，可重复调用，流式响应也可使用
+func TestResponseSimpleJson(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":12345678901234567890,"name":"requests"}`))
+	}))
+	defer server.Close()
+	session := NewSession()
+	for _, stream := range []bool{false, true} {
+		req := url.NewRequest()
+		req.Stream = stream
+		res, err := session.Get(server.URL, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			js, err := res.SimpleJson()
+			if err != nil {
+				t.Fatalf("stream=%v call %d: %v", stream, i, err)
+			}
+			if name := js.Get("name").MustString(); name != "requests" {
+				t.Fatalf("stream=%v call %d: name = %q", stream, i, name)
+			}
+			if id := js.Get("id").Interface(); id == nil || id.(interface{ String() string }).String() != "12345678901234567890" {
+				t.Fatalf("stream=%v call %d: id = %v", stream, i, id)
+			}
+		}
+		if _, err = res.Json(); err != nil {
+			t.Fatalf("stream=%v: Json after SimpleJson: %v", stream, err)
+		}
+	}
+}
+
+// 未声明编码时按内容检测，常用汉字区分GB18030与Big5
+func TestResponseDetectEncoding(t *testing.T) {
+	text := "这是一个没有声明编码的中文页面，我们需要根据内容判断它使用的编码。"
+	traditional := "這是一個沒有聲明編碼的中文頁面，我們需要根據內容判斷它使用的編碼。"
+	tests := []struct{ name, text string }{
+		{"gb18030", text},
+		{"big5", traditional},
+		{"shift_jis", "これは文字コードが宣言されていない日本語のページです。"},
+		{"euc-kr", "이것은 인코딩이 선언되지 않은 한국어 페이지입니다."},
+	}
+	for _, test := range tests {
+		e, _ := charset.Lookup(test.name)
+		content, err := e.NewEncoder().Bytes([]byte(test.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(content)
+		}))
+		res, err := NewSession().Get(server.URL, nil)
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Encoding != test.name || res.Text != test.text || res.EncodingError != nil {
+			t.Errorf("%s: encoding = %q, text = %q, err = %v", test.name, res.Encoding, res.Text, res.EncodingError)
+		}
+	}
+}
+
+// 解码失败时保留响应，Text按UTF-8解码，错误记录到EncodingError
+func TestResponseEncodingError(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Write([]byte("caf\xc3\xa9 \xff"))
+	}))
+	defer server.Close()
+	req := url.NewRequest()
+	req.Stream = true
+	res, err := NewSession().Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Encoding = "no-such-encoding"
+	if err = res.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if res.EncodingError == nil || res.Text != "caf\u00e9 \uFFFD" || string(res.Content) != "caf\xc3\xa9 \xff" {
+		t.Fatalf("text = %q, content = %q, err = %v", res.Text, res.Content, res.EncodingError)
+	}
+	if err = res.SetEncoding("windows-1252"); err != nil || res.EncodingError != nil || res.Text != "caf\u00c3\u00a9 \u00ff" {
+		t.Fatalf("SetEncoding: text = %q, err = %v, EncodingError = %v", res.Text, err, res.EncodingError)
+	}
+}
+
+// 记录是否被关闭的响应体，读完content后返回err
+type streamBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *streamBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func newStreamResponse(content string, err error) (*models.Response, *streamBody) {
+	var r io.Reader = strings.NewReader(content)
+	if err != nil {
+		r = io.MultiReader(r, &errReader{err})
+	}
+	body := &streamBody{Reader: r}
+	return &models.Response{Stream: true, Body: body}, body
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func collectChunks(res *models.Response, chunkSize int) ([]string, error) {
+	var chunks []string
+	for chunk, err := range res.IterContent(chunkSize) {
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, string(chunk))
+	}
+	return chunks, nil
+}
+
+func collectLines(res *models.Response) ([]string, error) {
+	var lines []string
+	for line, err := range res.IterLines() {
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// 每块最多chunkSize字节，chunkSize不大于0时按1字节迭代，流式与已读取的响应结果相同
+func TestResponseIterContent(t *testing.T) {
+	const content = "hello world!"
+	tests := []struct {
+		chunkSize int
+		want      []string
+	}{
+		{chunkSize: 5, want: []string{"hello", " worl", "d!"}},
+		{chunkSize: 12, want: []string{"hello world!"}},
+		{chunkSize: 100, want: []string{"hello world!"}},
+		{chunkSize: 0, want: strings.Split(content, "")},
+		{chunkSize: -1, want: strings.Split(content, "")},
+	}
+	for _, test := range tests {
+		res, body := newStreamResponse(content, nil)
+		chunks, err := collectChunks(res, test.chunkSize)
+		if err != nil || !reflect.DeepEqual(chunks, test.want) {
+			t.Errorf("stream chunkSize %d: chunks = %q, err = %v, want %q", test.chunkSize, chunks, err, test.want)
+		}
+		if !body.closed {
+			t.Errorf("stream chunkSize %d: body was not closed", test.chunkSize)
+		}
+
+		res = &models.Response{Content: []byte(content)}
+		if chunks, err = collectChunks(res, test.chunkSize); err != nil || !reflect.DeepEqual(chunks, test.want) {
+			t.Errorf("chunkSize %d: chunks = %q, err = %v, want %q", test.chunkSize, chunks, err, test.want)
+		}
+	}
+
+	// 读取出错时返回已读取的内容后返回错误
+	readErr := errors.New("connection reset")
+	res, body := newStreamResponse("abc", readErr)
+	chunks, err := collectChunks(res, 2)
+	if !errors.Is(err, readErr) || !reflect.DeepEqual(chunks, []string{"ab", "c"}) || !body.closed {
+		t.Fatalf("chunks = %q, err = %v, closed = %v", chunks, err, body.closed)
+	}
+}
+
+// 返回的行不含\n与\r\n，最后一行没有换行符时同样返回
+func TestResponseIterLines(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{content: "a\nb\n", want: []string{"a", "b"}},
+		{content: "a\r\nb\r\n", want: []string{"a", "b"}},
+		{content: "a\nb", want: []string{"a", "b"}},
+		{content: "a\r\n\r\nb", want: []string{"a", "", "b"}},
+		{content: "\n", want: []string{""}},
+		{content: "", want: nil},
+	}
+	for _, test := range tests {
+		res, body := newStreamResponse(test.content, nil)
+		lines, err := collectLines(res)
+		if err != nil || !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("stream %q: lines = %q, err = %v, want %q", test.content, lines, err, test.want)
+		}
+		if !body.closed {
+			t.Errorf("stream %q: body was not closed", test.content)
+		}
+
+		res = &models.Response{Content: []byte(test.content)}
+		if lines, err = collectLines(res); err != nil || !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("%q: lines = %q, err = %v, want %q", test.content, lines, err, test.want)
+		}
+	}
+
+	readErr := errors.New("connection reset")
+	res, _ := newStreamResponse("a\nb", readErr)
+	lines, err := collectLines(res)
+	if !errors.Is(err, readErr) || !reflect.DeepEqual(lines, []string{"a", "b"}) {
+		t.Fatalf("lines = %q, err = %v", lines, err)
+	}
+}
+
+// 提前结束迭代时关闭响应体，不再读取剩余内容
+func TestResponseIterStop(t *testing.T) {
+	res, body := newStreamResponse("line 1\nline 2\nline 3\n", nil)
+	for line := range res.IterLines() {
+		if line != "line 1" {
+			t.Fatalf("first line = %q", line)
+		}
+		break
+	}
+	if !body.closed {
+		t.Fatal("IterLines did not close the body after break")
+	}
+
+	res, body = newStreamResponse("hello world!", nil)
+	for chunk := range res.IterContent(5) {
+		if string(chunk) != "hello" {
+			t.Fatalf("first chunk = %q", chunk)
+		}
+		break
+	}
+	if !body.closed {
+		t.Fatal("IterContent did not close the body after break")
+	}
+	if rest, _ := io.ReadAll(body.Reader); string(rest) != " world!" {
+		t.Fatalf("IterContent read past the first chunk, %q left", rest)
+	}
+}
+
+// Load后从Content迭代，可重复迭代，再次调用Load不会重新读取
+func TestResponseIterAfterLoad(t *testing.T) {
+	res, body := newStreamResponse("a\r\nb", nil)
+	if err := res.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !body.closed || string(res.Content) != "a\r\nb" || res.Text != "a\r\nb" {
+		t.Fatalf("closed = %v, content = %q, text = %q", body.closed, res.Content, res.Text)
+	}
+	for i := 0; i < 2; i++ {
+		if lines, err := collectLines(res); err != nil || !reflect.DeepEqual(lines, []string{"a", "b"}) {
+			t.Fatalf("pass %d: lines = %q, err = %v", i, lines, err)
+		}
+		if chunks, err := collectChunks(res, 3); err != nil || !reflect.DeepEqual(chunks, []string{"a\r\n", "b"}) {
+			t.Fatalf("pass %d: chunks = %q, err = %v", i, chunks, err)
+		}
+	}
+	if err := res.Load(); err != nil || string(res.Content) != "a\r\nb" {
+		t.Fatalf("second Load: content = %q, err = %v", res.Content, err)
+	}
+}
+
+// 流式请求边接收边迭代，服务器分多次发送
+func TestResponseStreamLines(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		for _, part := range []string{"data: 1\r\n", "data: ", "2\n", "data: 3"} {
+			w.Write([]byte(part))
+			w.(nethttp.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	req := url.NewRequest()
+	req.Stream = true
+	res, err := NewSession().Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != nil {
+		t.Fatalf("stream response has content %q before iterating", res.Content)
+	}
+	lines, err := collectLines(res)
+	if err != nil || !reflect.DeepEqual(lines, []string{"data: 1", "data: 2", "data: 3"}) {
+		t.Fatalf("lines = %q, err = %v", lines, err)
+	}
+}
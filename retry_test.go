@@ -0,0 +1,166 @@
+package requests
+
+import (
+	"errors"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按顺序返回statuses中的状态码，之后返回200，记录每次收到的请求体
+type retryServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	statuses []int
+	header   nethttp.Header
+	bodies   []string
+}
+
+func newRetryServer(t *testing.T, header nethttp.Header, statuses ...int) *retryServer {
+	s := &retryServer{statuses: statuses, header: header}
+	s.Server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mutex.Lock()
+		n := len(s.bodies)
+		s.bodies = append(s.bodies, string(body))
+		s.mutex.Unlock()
+		if n < len(s.statuses) {
+			for key, values := range s.header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(s.statuses[n])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *retryServer) requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func testRetry() *url.Retry {
+	retry := url.NewRetry()
+	retry.BackoffFactor = time.Millisecond
+	retry.BackoffJitter = 0
+	return retry
+}
+
+// 按状态码重试，POST允许重试时每次都重新发送相同的请求体
+func TestRetryStatusResendsBody(t *testing.T) {
+	server := newRetryServer(t, nil, 503, 502)
+	req := url.NewRequest()
+	req.Retry = testRetry()
+	req.Retry.Methods = []string{"POST"}
+	req.Body = strings.NewReader("payload")
+	r, err := NewSession().Post(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 200 || r.Text != "ok" {
+		t.Fatalf("status = %d, text = %q", r.StatusCode, r.Text)
+	}
+	if bodies := server.requests(); len(bodies) != 3 || bodies[0] != "payload" || bodies[1] != "payload" || bodies[2] != "payload" {
+		t.Fatalf("server received %q", bodies)
+	}
+	if len(r.Attempts) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(r.Attempts))
+	}
+	for i, want := range []int{503, 502, 200} {
+		if r.Attempts[i].StatusCode != want {
+			t.Errorf("attempt %d status = %d, want %d", i, r.Attempts[i].StatusCode, want)
+		}
+	}
+	if r.Attempts[0].Delay != time.Millisecond || r.Attempts[1].Delay != 2*time.Millisecond || r.Attempts[2].Delay != 0 {
+		t.Errorf("delays = %s, %s, %s", r.Attempts[0].Delay, r.Attempts[1].Delay, r.Attempts[2].Delay)
+	}
+}
+
+// 达到MaxAttempts后返回最后一次的响应，不允许重试的方法与状态码只发送一次
+func TestRetryLimits(t *testing.T) {
+	server := newRetryServer(t, nil, 503, 503, 503, 503)
+	req := url.NewRequest()
+	req.Retry = testRetry()
+	req.Retry.MaxAttempts = 2
+	r, err := NewSession().Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 503 || len(r.Attempts) != 2 || len(server.requests()) != 2 {
+		t.Fatalf("status = %d, attempts = %d, requests = %d", r.StatusCode, len(r.Attempts), len(server.requests()))
+	}
+
+	// POST默认不重试
+	req.Body = strings.NewReader("payload")
+	if r, err = NewSession().Post(server.URL, req); err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 503 || len(r.Attempts) != 1 || len(server.requests()) != 3 {
+		t.Fatalf("POST: status = %d, attempts = %d, requests = %d", r.StatusCode, len(r.Attempts), len(server.requests()))
+	}
+
+	// 404不在重试的状态码中
+	server = newRetryServer(t, nil, 404)
+	req = url.NewRequest()
+	req.Retry = testRetry()
+	if r, err = NewSession().Get(server.URL, req); err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 404 || len(r.Attempts) != 1 {
+		t.Fatalf("404: status = %d, attempts = %d", r.StatusCode, len(r.Attempts))
+	}
+}
+
+// 遵循响应的Retry-After等待
+func TestRetryAfter(t *testing.T) {
+	server := newRetryServer(t, nethttp.Header{"Retry-After": {"1"}}, 429)
+	req := url.NewRequest()
+	req.Retry = testRetry()
+	start := time.Now()
+	r, err := NewSession().Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, want at least 1s", elapsed)
+	}
+	if r.StatusCode != 200 || len(r.Attempts) != 2 || r.Attempts[0].Delay != time.Second {
+		t.Fatalf("status = %d, attempts = %d, delay = %s", r.StatusCode, len(r.Attempts), r.Attempts[0].Delay)
+	}
+}
+
+// 连接失败按错误类型重试，达到次数后返回包含次数的错误
+func TestRetryConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	req := url.NewRequest()
+	req.Retry = testRetry()
+	_, err = NewSession().Get("http://"+addr, req)
+	if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Fatalf("err = %v, want giving up after 3 attempts", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("err = %v, want a wrapped *net.OpError", err)
+	}
+
+	req.Retry.Errors = url.RetryTimeoutError
+	if _, err = NewSession().Get("http://"+addr, req); err == nil || strings.Contains(err.Error(), "giving up") {
+		t.Fatalf("err = %v, want a single attempt", err)
+	}
+}
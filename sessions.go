@@ -4,27 +4,31 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"crypto/x509"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
 	utls "github.com/refraction-networking/utls"
 	"github.com/wangluozhe/chttp"
 	"github.com/wangluozhe/chttp/cookiejar"
+	"github.com/wangluozhe/chttp/httptrace"
 	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/profiles"
+	"github.com/wangluozhe/requests/transport"
 	"github.com/wangluozhe/requests/url"
 	"github.com/wangluozhe/requests/utils"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	url2 "net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-var mutex = &sync.RWMutex{}
-
 // 默认User—Agent
 func default_user_agent() string {
 	return USER_AGENT
@@ -46,49 +50,62 @@ func merge_cookies(rawurl string, cookieJar *cookiejar.Jar, cookie *cookiejar.Ja
 	cookieJar.SetCookies(urls, cookie.Cookies(urls))
 }
 
-// 合并参数
+// 合并参数，session中的参数会先复制一份，避免请求参数写回session
 func merge_setting(request_setting, session_setting interface{}) interface{} {
 	switch (request_setting).(type) {
 	case *url.Params:
-		merged_setting := session_setting.(*url.Params)
-		if merged_setting == nil {
+		session_params := session_setting.(*url.Params)
+		if session_params == nil {
 			return request_setting
 		}
 		requestd_setting := request_setting.(*url.Params)
 		if requestd_setting == nil {
-			return merged_setting
+			return session_params
+		}
+		merged_setting := url.NewParams()
+		values := session_params.Values()
+		for _, key := range session_params.Keys() {
+			for _, value := range values[key] {
+				merged_setting.Add(key, value)
+			}
 		}
 		for _, key := range requestd_setting.Keys() {
 			merged_setting.Set(key, requestd_setting.Get(key))
 		}
 		return merged_setting
 	case *http.Header:
-		merged_setting := session_setting.(*http.Header)
-		if merged_setting == nil {
+		session_headers := session_setting.(*http.Header)
+		if session_headers == nil {
 			return request_setting
 		}
 		requestd_setting := request_setting.(*http.Header)
 		if requestd_setting == nil {
-			return merged_setting
+			return session_headers
 		}
+		merged_setting := session_headers.Clone()
 		for key, _ := range *requestd_setting {
 			if key == http.PHeaderOrderKey || key == http.HeaderOrderKey || key == http.UnChangedHeaderKey {
 				continue
 			}
 			merged_setting.Set(key, (*requestd_setting)[key][0])
 		}
-		return merged_setting
+		return &merged_setting
 	case []string:
-		merged_setting := session_setting.([]string)
-		if merged_setting == nil {
+		session_values := session_setting.([]string)
+		if session_values == nil {
 			return request_setting
 		}
 		requestd_setting := request_setting.([]string)
 		if requestd_setting == nil {
-			return merged_setting
+			return session_values
 		}
+		merged_setting := append([]string(nil), session_values...)
 		for index, value := range requestd_setting {
-			merged_setting[index] = value
+			if index < len(merged_setting) {
+				merged_setting[index] = value
+			} else {
+				merged_setting = append(merged_setting, value)
+			}
 		}
 		return merged_setting
 	case bool:
@@ -137,6 +154,7 @@ var disableRedirect = func(request *http.Request, via []*http.Request) error {
 const (
 	DEFAULT_REDIRECT_LIMIT = 30 // 默认redirect最大次数
 	DEFAULT_TIMEOUT        = 30 // 默认client响应时间
+	DEFAULT_RESEND_LIMIT   = 10 // 默认中间件重新发送最大次数
 )
 
 // 新建默认Session
@@ -146,48 +164,60 @@ func NewSession() *Session {
 		Cookies:      nil,
 		Verify:       true,
 		MaxRedirects: DEFAULT_REDIRECT_LIMIT,
-		transport:    nil,
-		request:      nil,
-		client:       nil,
 	}
 	cookies, _ := cookiejar.New(nil)
 	session.Cookies = cookies
-	session.transport = &http.Transport{
-		TLSClientConfig: &utls.Config{
-			InsecureSkipVerify:     session.Verify,
-			ClientSessionCache:     utls.NewLRUClientSessionCache(0),
-			OmitEmptyPsk:           true,
-			SessionTicketsDisabled: true,
-		},
-		DisableKeepAlives: false,
-	}
-	session.request = &http.Request{}
-	session.client = &http.Client{
-		Transport:     session.transport,
-		CheckRedirect: nil,
-		Timeout:       DEFAULT_TIMEOUT * time.Second,
-	}
 	return session
 }
 
 var defaultSession = NewSession()
 
-// Session结构体
+// Session结构体，可在多个goroutine中并发使用
 type Session struct {
-	Params        *url.Params
-	Headers       *http.Header
-	Cookies       *cookiejar.Jar
-	Auth          []string
-	Proxies       string
-	Verify        bool
-	Cert          []string
-	Ja3           string
-	MaxRedirects  int
-	TLSExtensions *http.TLSExtensions
-	HTTP2Settings *http.HTTP2Settings
-	transport     *http.Transport
-	request       *http.Request
-	client        *http.Client
+	Params       *url.Params
+	Headers      *http.Header
+	Cookies      *cookiejar.Jar // 直接调用Cookies.SetCookies写入的Cookie不会被CookieJar、ExportCookies与Snapshot读取
+	Auth         []string
+	Proxies      string
+	ProxyHeaders *http.Header // 通过代理建立隧道时CONNECT请求附带的请求头，支持Header-Order:排序
+	// 是否校验服务器证书，默认为true，为false时跳过校验。
+	//
+	// Deprecated: 使用InsecureSkipVerify。
+	Verify             bool
+	InsecureSkipVerify bool // 跳过服务器证书校验
+	Cert               []string
+	TLSConfig          *url.TLSConfig
+	Ja3                string
+	Ja4                string // JA4_r或JA4_ro字符串，与Ja3二选一
+	MaxRedirects       int
+	Redirect           *url.Redirect // 重定向策略，请求中的Redirect优先
+	TLSExtensions      *http.TLSExtensions
+	ExtraExtensions    *transport.ExtraExtensions // ALPN、ECH、Padding等TLSExtensions之外的ClientHello设置
+	HTTP2Settings      *http.HTTP2Settings
+	Retry              *url.Retry
+	ProxyPool          *url.ProxyPool // 设置后忽略Proxies，每次请求从代理池中选择代理
+	Middlewares        []models.Middleware
+	Pool               *url.Pool     // 连接池配置，为nil时使用chttp的默认值
+	Timeouts           *url.Timeouts // 分阶段的超时设置，请求中的Timeouts与Timeout优先
+	transports         transportCache
+	stats              connStats
+	cookieFile         atomic.Pointer[cookieFile] // PersistCookies设置的Cookie文件
+	cookies            *cookieStore               // 记录写入Cookies的Cookie，由cookieStore()创建
+	mutex              sync.Mutex
+}
+
+// 应用浏览器指纹模板，设置JA3、TLS扩展、HTTP2指纹及请求头，模板名称见profiles.Names()
+func (s *Session) ApplyProfile(name string) error {
+	p, err := profiles.Get(name)
+	if err != nil {
+		return err
+	}
+	s.Ja3, s.Ja4 = p.JA3, ""
+	s.TLSExtensions = p.ToTLSExtensions()
+	s.ExtraExtensions = p.ToExtraExtensions()
+	s.HTTP2Settings = p.ToHTTP2Settings()
+	s.Headers = p.Header()
+	return nil
 }
 
 // 预请求处理
@@ -239,8 +269,6 @@ func (s *Session) Request(method, rawurl string, request *url.Request) (*models.
 		Body:    request.Body,
 		Auth:    request.Auth,
 	}
-	mutex.Lock()
-	defer mutex.Unlock()
 	preq, err := s.Prepare_request(req)
 	if err != nil {
 		return nil, err
@@ -252,6 +280,16 @@ func (s *Session) Request(method, rawurl string, request *url.Request) (*models.
 	return resp, nil
 }
 
+// 携带上下文的http请求，上下文取消时会中断TLS握手、响应体读取和解码
+func (s *Session) RequestWithContext(ctx context.Context, method, rawurl string, request *url.Request) (*models.Response, error) {
+	if request == nil {
+		request = url.NewRequest()
+	}
+	r := *request
+	r.Context = ctx
+	return s.Request(method, rawurl, &r)
+}
+
 // get请求方式
 func (s *Session) Get(rawurl string, req *url.Request) (*models.Response, error) {
 	return s.Request(http.MethodGet, rawurl, req)
@@ -297,271 +335,481 @@ func (s *Session) Trace(rawurl string, req *url.Request) (*models.Response, erro
 	return s.Request(http.MethodTrace, rawurl, req)
 }
 
-// 发送数据
+// 发送数据，依次执行Session与请求上下文中注册的中间件
 func (s *Session) Send(preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
-	var err error
-	var history []*models.Response
+	middlewares := append([]models.Middleware(nil), s.Middlewares...)
+	middlewares = append(middlewares, models.MiddlewaresFrom(req.Context)...)
+	if len(middlewares) == 0 {
+		return s.sendWithRetry(preq, req)
+	}
 
-	// 设置代理
-	proxies := merge_setting(s.Proxies, req.Proxies).(string)
-	if proxies != "" {
-		u1, err := url2.Parse(proxies)
+	// 缓存请求体，保证重新发送时数据相同
+	var body []byte
+	var err error
+	if preq.Body != nil {
+		body, err = ioutil.ReadAll(preq.Body)
 		if err != nil {
 			return nil, err
 		}
-		s.transport.Proxy = http.ProxyURL(u1)
-	} else {
-		s.transport.Proxy = nil
 	}
-
-	// 是否验证证书
-	verify := merge_setting(s.Verify, req.Verify).(bool)
-	s.transport.TLSClientConfig.InsecureSkipVerify = verify
-
-	// 设置证书
-	cert := merge_setting(s.Cert, req.Cert).([]string)
-	if cert != nil {
-		var cert_byte []byte
-		certs, err := utls.LoadX509KeyPair(cert[0], cert[1])
-		if err != nil {
-			return nil, err
+	for n := 0; ; n++ {
+		if body != nil {
+			preq.Body = bytes.NewReader(body)
 		}
-		if len(cert) == 3 {
-			cert_byte, err = ioutil.ReadFile(cert[2])
-		} else {
-			cert_byte, err = ioutil.ReadFile(cert[0])
+		var response *models.Response
+		for _, middleware := range middlewares {
+			response, err = middleware.BeforeRequest(preq)
+			if err != nil {
+				return nil, err
+			}
+			if response != nil {
+				if response.Request == nil {
+					response.Request = req
+				}
+				return response, nil
+			}
 		}
+		response, err = s.sendWithRetry(preq, req)
 		if err != nil {
 			return nil, err
 		}
-		certPool := x509.NewCertPool()
-		ok := certPool.AppendCertsFromPEM(cert_byte)
-		if !ok {
-			return nil, errors.New("failed to parse root certificate")
-		}
-		s.transport.TLSClientConfig.RootCAs = certPool
-		s.transport.TLSClientConfig.Certificates = []utls.Certificate{certs}
-	}
-
-	// 设置JA3指纹信息
-	ja3String := merge_setting(s.Ja3, req.Ja3).(string)
-	if ja3String != "" && strings.HasPrefix(preq.Url, "https") && s.transport.H2Transport == nil {
-		if s.transport.TLSClientConfig.ClientSessionCache == nil {
-			s.transport.TLSClientConfig.ClientSessionCache = utls.NewLRUClientSessionCache(0)
-		}
-		if s.transport.TLSClientConfig.OmitEmptyPsk == false {
-			s.transport.TLSClientConfig.OmitEmptyPsk = true
-		}
-		if s.transport.TLSClientConfig.SessionTicketsDisabled == false {
-			s.transport.TLSClientConfig.SessionTicketsDisabled = true
-		}
-		if strings.Index(strings.Split(ja3String, ",")[2], "-41") != -1 {
-			s.transport.TLSClientConfig.SessionTicketsDisabled = false
-		}
-		if s.transport.H2Transport == nil {
-			var h2 *http.HTTP2Transport
-			h2, _ = http.HTTP2ConfigureTransports(s.transport)
-			s.transport.JA3 = ja3String
-			s.transport.UserAgent = s.Headers.Get("User-Agent")
-			// 自定义TLS指纹信息
-			tlsExtensions := merge_setting(req.TLSExtensions, s.TLSExtensions).(*http.TLSExtensions)
-			http2Settings := merge_setting(req.HTTP2Settings, s.HTTP2Settings).(*http.HTTP2Settings)
-			h2.HTTP2Settings = http2Settings
-			if http2Settings != nil {
-				if http2Settings.Settings != nil {
-					for _, setting := range http2Settings.Settings {
-						switch setting.ID {
-						case http.HTTP2SettingHeaderTableSize:
-							h2.MaxEncoderHeaderTableSize = setting.Val
-							h2.MaxDecoderHeaderTableSize = setting.Val
-						case http.HTTP2SettingMaxConcurrentStreams:
-							h2.StrictMaxConcurrentStreams = true
-						case http.HTTP2SettingMaxFrameSize:
-							h2.MaxReadFrameSize = setting.Val
-						case http.HTTP2SettingMaxHeaderListSize:
-							h2.MaxHeaderListSize = setting.Val
-						}
-					}
-				}
-				s.transport.TLSExtensions = tlsExtensions
-				s.transport.H2Transport = h2
+		resend := false
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			again, err := middlewares[i].AfterResponse(response)
+			if err != nil {
+				response.Body.Close()
+				return nil, err
 			}
+			resend = resend || again
+		}
+		if !resend {
+			return response, nil
 		}
-	} else if ja3String != "" && strings.HasPrefix(preq.Url, "https") && s.transport.H2Transport != nil {
-		s.transport.JA3 = ja3String
-		s.transport.UserAgent = s.Headers.Get("User-Agent")
-		// 自定义TLS指纹信息
-		tlsExtensions := merge_setting(req.TLSExtensions, s.TLSExtensions).(*http.TLSExtensions)
-		http2Settings := merge_setting(req.HTTP2Settings, s.HTTP2Settings).(*http.HTTP2Settings)
-		s.transport.H2Transport.(*http.HTTP2Transport).HTTP2Settings = http2Settings
-		s.transport.TLSExtensions = tlsExtensions
+		response.Body.Close()
+		if n >= DEFAULT_RESEND_LIMIT {
+			return nil, fmt.Errorf("middlewares requested more than %d resends", DEFAULT_RESEND_LIMIT)
+		}
+	}
+}
+
+// 发送数据，配置了Retry时按重试策略重复发送
+func (s *Session) sendWithRetry(preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
+	// 设置有序请求头
+	MergeHeaderOrder(preq, req)
+	// 在发送前检查指纹设置，配置错误不进入重试
+	if _, err := s.FingerprintSettings(preq, req); err != nil {
+		return nil, err
 	}
 
-	// 设置超时时间
-	timeout := req.Timeout
-	if timeout != 0 {
-		s.client.Timeout = timeout
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	// 是否自动转发
-	allowRedirect := req.AllowRedirects
-	if allowRedirect {
-		s.client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
-			if len(via) > s.MaxRedirects {
-				return errors.New(fmt.Sprintf("redirects number gt %i", s.MaxRedirects))
-			}
-			if request != nil {
-				preq.Url = request.URL.String()
-				p := models.NewPrepareRequest()
-				c, _ := cookiejar.New(nil)
-				c.SetCookies(request.URL, request.Cookies())
-				p.Prepare(request.Method, request.URL.String(), nil, &request.Header, c, nil, nil, nil, nil, nil)
-				r, err := s.buildResponse(request.Response, p, &url.Request{})
-				if err != nil {
-					return err
-				}
-				history = append(history, r)
+	retry := req.Retry
+	if retry == nil {
+		retry = s.Retry
+	}
+	if retry == nil || retry.MaxAttempts <= 1 || !retry.AllowMethod(preq.Method) {
+		start := time.Now()
+		response, err := s.sendProxied(ctx, preq, req)
+		if err != nil {
+			return nil, err
+		}
+		response.Attempts = []*models.Attempt{{StatusCode: response.StatusCode, Elapsed: time.Since(start)}}
+		return response, nil
+	}
+
+	// 缓存请求体，保证每次重试发送相同的数据
+	var body []byte
+	if preq.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(preq.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rawurl := preq.Url
+	var attempts []*models.Attempt
+	for n := 1; ; n++ {
+		if body != nil {
+			preq.Body = bytes.NewReader(body)
+		}
+		preq.Url = rawurl
+		start := time.Now()
+		response, err := s.sendProxied(ctx, preq, req)
+		attempt := &models.Attempt{Err: err, Elapsed: time.Since(start)}
+		attempts = append(attempts, attempt)
+		var header http.Header
+		if err == nil {
+			attempt.StatusCode = response.StatusCode
+			header = response.Headers
+			if n >= retry.MaxAttempts || !retry.AllowStatus(response.StatusCode) {
+				response.Attempts = attempts
+				return response, nil
 			}
-			// 获取上一次请求的Cookies
-			var cookies []*http.Cookie
-			lastReq := via[len(via)-1]
-			if lastReq.Response != nil {
-				cookies = lastReq.Response.Cookies()
+		} else if n >= retry.MaxAttempts || ctx.Err() != nil || retryErrorClass(err)&retry.Errors == 0 {
+			if n > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", n, err)
 			}
+			return nil, err
+		}
 
-			// 将上一次请求的Cookies与当前请求的Cookies合并
-			reqCookies := append(cookies, request.Cookies()...)
+		attempt.Delay = retry.Delay(n, header)
+		if response != nil {
+			response.Body.Close()
+		}
+		timer := time.NewTimer(attempt.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
 
-			// 设置合并后的Cookies到重定向请求的Header中
-			for _, cookie := range reqCookies {
-				request.AddCookie(cookie)
-			}
-			return nil
+// 获取Transport并发送一次请求，使用代理池时每次发送都重新选择代理
+func (s *Session) sendProxied(ctx context.Context, preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
+	key, err := s.transportKey(preq, req)
+	if err != nil {
+		return nil, err
+	}
+	pool := req.ProxyPool
+	if pool == nil {
+		pool = s.ProxyPool
+	}
+	if req.Proxies != "" {
+		pool = nil
+	}
+	if pool != nil {
+		u, err := url2.Parse(preq.Url)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		s.client.CheckRedirect = disableRedirect
+		key.proxies, err = pool.Pick(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		key.proxyPool = pool
 	}
 
-	// 设置有序请求头
-	if req.Headers != nil {
-		if (*req.Headers)[http.HeaderOrderKey] != nil {
-			(*preq.Headers)[http.HeaderOrderKey] = (*req.Headers)[http.HeaderOrderKey]
+	// 获取本次请求配置对应的Transport
+	transport, err := s.getTransport(key)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.send(ctx, transport, preq, req)
+	if pool != nil {
+		if err == nil {
+			pool.MarkSuccess(key.proxies)
+		} else if ctx.Err() == nil {
+			pool.MarkFailure(key.proxies)
 		}
-		if (*req.Headers)[http.PHeaderOrderKey] != nil {
-			(*preq.Headers)[http.PHeaderOrderKey] = (*req.Headers)[http.PHeaderOrderKey]
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.Proxy = key.proxies
+	return response, nil
+}
+
+// 判断错误所属的重试类型
+func retryErrorClass(err error) url.RetryError {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return url.RetryTimeoutError
+	}
+	var certErr *utls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) {
+		return 0
+	}
+	var recordErr utls.RecordHeaderError
+	if errors.As(err, &recordErr) || strings.Contains(err.Error(), "tls: ") {
+		return url.RetryTLSError
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return url.RetryConnectError
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return url.RetryResetError
+	}
+	return 0
+}
+
+// 发送一次请求
+func (s *Session) send(ctx context.Context, transport *http.Transport, preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
+	// 超时设置只作用于本次请求，超时后以*url.TimeoutError取消上下文
+	timeouts := s.timeouts(req)
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, timeoutsKey{}, timeouts))
+	ctx = withRequestContext(ctx)
+	expire := func(phase url.TimeoutPhase, timeout time.Duration) func() {
+		return func() {
+			cancel(&url.TimeoutError{Phase: phase, Duration: timeout})
 		}
-		if (*req.Headers)[http.UnChangedHeaderKey] != nil {
-			(*preq.Headers)[http.UnChangedHeaderKey] = (*req.Headers)[http.UnChangedHeaderKey]
+	}
+	totalTimer := time.AfterFunc(timeouts.Total, expire(url.TimeoutTotal, timeouts.Total))
+	var headerTimer *time.Timer
+	if timeouts.ResponseHeader > 0 {
+		headerTimer = time.AfterFunc(timeouts.ResponseHeader, expire(url.TimeoutResponseHeader, timeouts.ResponseHeader))
+	}
+	finish := func() {
+		totalTimer.Stop()
+		if headerTimer != nil {
+			headerTimer.Stop()
 		}
+		cancel(nil)
+	}
+
+	// 记录连接与耗时，重定向时每个请求分别记录
+	recorder := &traceRecorder{}
+	ctx = httptrace.WithClientTrace(ctx, recorder.clientTrace())
+	start := time.Now()
+
+	// 重定向由Session按请求的重定向策略处理，不使用chttp的自动跳转
+	client := &http.Client{
+		Transport:     &statsTransport{Transport: transport, stats: &s.stats},
+		Jar:           preq.Cookies,
+		CheckRedirect: disableRedirect,
 	}
 
-	s.request, err = http.NewRequest(preq.Method, preq.Url, preq.Body)
+	request, err := http.NewRequestWithContext(ctx, preq.Method, preq.Url, preq.Body)
 	if err != nil {
-		log.Fatalln(err)
+		finish()
 		return nil, err
 	}
-	s.request.Header = *preq.Headers
-	s.client.Jar = preq.Cookies
-	req.Headers = &s.request.Header
-	resp, err := s.client.Do(s.request)
+	request.Header = *preq.Headers
+	resp, history, err := s.do(client, request, preq, req, recorder)
+	// 收到响应头后停止响应头计时，流式响应的总超时同样只计算到收到响应头
+	if err == nil && (headerTimer != nil && !headerTimer.Stop() || req.Stream && !totalTimer.Stop()) {
+		resp.Body.Close()
+		err = context.Cause(ctx)
+	}
 	if err != nil {
+		err = timeoutError(ctx, err)
+		finish()
 		return nil, err
 	}
-	response, err := s.buildResponse(resp, preq, req)
+	if timeouts.BodyIdle > 0 {
+		resp.Body = newIdleTimeoutReader(resp.Body, timeouts.BodyIdle, expire(url.TimeoutBodyIdle, timeouts.BodyIdle))
+	}
+	// 复制一份请求参数记录实际发送的请求头，不修改调用方传入的参数
+	sent := *req
+	sent.Headers = &resp.Request.Header
+	final := *preq
+	final.Url = resp.Request.URL.String()
+	bodyStart := time.Now()
+	response, err := s.buildResponse(resp, &final, &sent)
 	if err != nil {
+		err = timeoutError(ctx, err)
+		finish()
 		return nil, err
 	}
+	response.Elapsed = time.Since(start)
+	response.Trace = recorder.snapshot()
+	if !req.Stream {
+		response.Trace.BodyRead = time.Since(bodyStart)
+	}
+	if req.Stream {
+		response.Body = &timeoutBody{ReadCloser: response.Body, ctx: ctx, close: finish}
+	} else {
+		finish()
+	}
 	response.History = history
 	return response, nil
 }
 
-// 构建response参数
-func (s *Session) buildResponse(resp *http.Response, preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
-	if resp.Body != nil {
-		defer resp.Body.Close()
-	}
-	content, err := ioutil.ReadAll(resp.Body)
+// 合并session与请求中影响连接的配置
+func (s *Session) transportKey(preq *models.PrepareRequest, req *url.Request) (transportKey, error) {
+	settings, err := s.FingerprintSettings(preq, req)
 	if err != nil {
-		return nil, err
+		return transportKey{}, err
 	}
-	encoding := resp.Header.Get("Content-Encoding")
-	DecompressBody(&content, encoding)
-	body := ioutil.NopCloser(bytes.NewReader(content))
+	key := transportKey{
+		proxies:       merge_setting(req.Proxies, s.Proxies).(string),
+		proxyHeaders:  merge_setting(req.ProxyHeaders, s.ProxyHeaders).(*http.Header),
+		tlsConfig:     s.TLSConfig,
+		cert:          strings.Join(merge_setting(req.Cert, s.Cert).([]string), "\x00"),
+		ja3:           settings.Ja3,
+		ja4:           settings.Ja4,
+		userAgent:     settings.UserAgent,
+		tlsExtensions: settings.TLSExtensions,
+		extra:         settings.ExtraExtensions,
+		http2Settings: settings.HTTP2Settings,
+		forceHTTP1:    settings.ForceHTTP1,
+		forceHTTP2:    settings.ForceHTTP2,
+		useHTTP2:      settings.UseHTTP2,
+	}
+	if s.Pool != nil {
+		key.pool = *s.Pool
+	}
+	if req.TLSConfig != nil {
+		key.tlsConfig = req.TLSConfig
+	}
+	// Session的Verify为false或任一InsecureSkipVerify为true时跳过证书校验，请求的Verify无法区分未设置与false，不参与判断
+	key.insecureSkipVerify = !s.Verify || req.InsecureSkipVerify || s.InsecureSkipVerify
+	return key, nil
+}
+
+// 构建response参数
+func (s *Session) buildResponse(resp *http.Response, preq *models.PrepareRequest, req *url.Request) (*models.Response, error) {
 	response := &models.Response{
 		Url:        preq.Url,
 		Headers:    resp.Header,
 		Cookies:    resp.Cookies(),
-		Text:       string(content),
-		Content:    content,
-		Body:       body,
 		StatusCode: resp.StatusCode,
 		History:    []*models.Response{},
 		Request:    req,
+		Proto:      resp.Proto,
+		TLS:        resp.TLS,
 	}
-	if resp.Cookies() != nil {
+	encoding := resp.Header.Get("Content-Encoding")
+	if req.Stream {
+		body, err := decompressReader(resp.Body, encoding)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		response.Body = body
+		response.Stream = true
+	} else {
+		defer resp.Body.Close()
+		content, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err = decompressBody(resp.Request.Context(), &content, encoding); err != nil {
+			return nil, err
+		}
+		response.Content = content
+		response.Encoding = models.DetectEncoding(content, resp.Header.Get("Content-Type"))
+		response.DecodeContent()
+		response.Body = ioutil.NopCloser(bytes.NewReader(content))
+	}
+	if len(response.Cookies) > 0 {
 		u, _ := url2.Parse(preq.Url)
-		s.Cookies.SetCookies(u, resp.Cookies())
+		s.cookieStore().SetCookies(u, response.Cookies)
+		s.autoSaveCookies()
 	}
 	return response, nil
 }
 
 // 解码Body数据
 func DecompressBody(content *[]byte, encoding string) {
+	decompressBody(context.Background(), content, encoding)
+}
+
+// 解码Body数据，上下文取消时中断解码并返回取消原因，其余解码错误保留原始数据
+func decompressBody(ctx context.Context, content *[]byte, encoding string) error {
+	var err error
 	if encoding != "" {
 		if strings.ToLower(encoding) == "gzip" {
-			decodeGZip(content)
+			err = decodeGZip(ctx, content)
 		} else if strings.ToLower(encoding) == "deflate" {
-			decodeDeflate(content)
+			err = decodeDeflate(ctx, content)
 		} else if strings.ToLower(encoding) == "br" {
-			decodeBrotli(content)
+			err = decodeBrotli(ctx, content)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// 返回边读边解码的响应体，关闭时同时关闭原始响应体
+func decompressReader(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
 		}
+		return &readCloser{Reader: r, close: func() error {
+			r.Close()
+			return body.Close()
+		}}, nil
+	case "deflate":
+		r := flate.NewReader(body)
+		return &readCloser{Reader: r, close: func() error {
+			r.Close()
+			return body.Close()
+		}}, nil
+	case "br":
+		return &readCloser{Reader: brotli.NewReader(body), close: body.Close}, nil
 	}
+	return body, nil
+}
+
+// 自定义关闭行为的ReadCloser
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
+
+// 可被上下文取消的Reader
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
 }
 
 // 解码GZip编码
-func decodeGZip(content *[]byte) error {
+func decodeGZip(ctx context.Context, content *[]byte) error {
 	if content == nil {
 		return nil
 	}
-	b := new(bytes.Buffer)
-	binary.Write(b, binary.LittleEndian, content)
-	r, err := gzip.NewReader(b)
+	r, err := gzip.NewReader(bytes.NewReader(*content))
 	if err != nil {
 		return err
 	}
 	defer r.Close()
-	*content, err = ioutil.ReadAll(r)
+	decoded, err := ioutil.ReadAll(&contextReader{ctx, r})
 	if err != nil {
 		return err
 	}
+	*content = decoded
 	return nil
 }
 
 // 解码deflate编码
-func decodeDeflate(content *[]byte) error {
-	var err error
+func decodeDeflate(ctx context.Context, content *[]byte) error {
 	if content == nil {
-		return err
+		return nil
 	}
 	r := flate.NewReader(bytes.NewReader(*content))
 	defer r.Close()
-	*content, err = ioutil.ReadAll(r)
+	decoded, err := ioutil.ReadAll(&contextReader{ctx, r})
 	if err != nil {
 		return err
 	}
+	*content = decoded
 	return nil
 }
 
 // 解码br编码
-func decodeBrotli(content *[]byte) error {
-	var err error
+func decodeBrotli(ctx context.Context, content *[]byte) error {
 	if content == nil {
-		return err
+		return nil
 	}
 	r := brotli.NewReader(bytes.NewReader(*content))
-	*content, err = ioutil.ReadAll(r)
+	decoded, err := ioutil.ReadAll(&contextReader{ctx, r})
 	if err != nil {
 		return err
 	}
+	*content = decoded
 	return nil
 }
@@ -0,0 +1,175 @@
+package requests
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/chttp/cookiejar"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	"time"
+)
+
+// Session快照的格式版本，格式不兼容时递增
+const SnapshotVersion = 1
+
+// Session的全部设置与Cookie，TLS扩展与HTTP2设置使用transport.Extensions与transport.H2Settings的形式。
+// 中间件、ProxyPool.Provider与TLSConfig.VerifyPeerCertificate等函数无法保存，恢复后需重新设置
+type SessionSnapshot struct {
+	Version            int                   `json:"version"`
+	Params             []SnapshotParam       `json:"params,omitempty"` // 保持参数顺序
+	Headers            *http.Header          `json:"headers,omitempty"`
+	Cookies            []*Cookie             `json:"cookies,omitempty"`
+	Auth               []string              `json:"auth,omitempty"`
+	Proxies            string                `json:"proxies,omitempty"`
+	ProxyHeaders       *http.Header          `json:"proxyHeaders,omitempty"`
+	ProxyPool          *SnapshotProxyPool    `json:"proxyPool,omitempty"`
+	Verify             bool                  `json:"verify"`
+	InsecureSkipVerify bool                  `json:"insecureSkipVerify"`
+	Cert               []string              `json:"cert,omitempty"`
+	TLSConfig          *url.TLSConfig        `json:"tlsConfig,omitempty"`
+	Ja3                string                `json:"ja3,omitempty"`
+	Ja4                string                `json:"ja4,omitempty"`
+	TLSExtensions      *transport.Extensions `json:"tlsExtensions,omitempty"`
+	HTTP2Settings      *transport.H2Settings `json:"http2Settings,omitempty"`
+	MaxRedirects       int                   `json:"maxRedirects"`
+	Redirect           *url.Redirect         `json:"redirect,omitempty"`
+	Retry              *url.Retry            `json:"retry,omitempty"`
+	Pool               *url.Pool             `json:"pool,omitempty"`
+	Timeouts           *url.Timeouts         `json:"timeouts,omitempty"` // 时长以纳秒为单位
+}
+
+// 一个URL参数及其全部值
+type SnapshotParam struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// 代理池的设置与代理列表，不包含代理的使用与失败记录
+type SnapshotProxyPool struct {
+	Proxies     []string          `json:"proxies"`
+	Strategy    url.ProxyStrategy `json:"strategy"`
+	MaxFailures int               `json:"maxFailures"`
+	Cooldown    time.Duration     `json:"cooldown"`
+}
+
+// 生成Session的快照，返回JSON文档，可用RestoreSession恢复。
+// 不包含TLSConfig中的客户端私钥、PKCS#12内容与密码，恢复后需重新设置；Cookie、Auth与代理认证信息仍会保存
+func (s *Session) Snapshot() ([]byte, error) {
+	return s.snapshot(false)
+}
+
+// 与Snapshot相同，但同时保存TLSConfig中的客户端私钥、PKCS#12内容与密码，文档需妥善保管
+func (s *Session) SnapshotWithSecrets() ([]byte, error) {
+	return s.snapshot(true)
+}
+
+func (s *Session) snapshot(secrets bool) ([]byte, error) {
+	snapshot := &SessionSnapshot{
+		Version:            SnapshotVersion,
+		Headers:            s.Headers,
+		Auth:               s.Auth,
+		Proxies:            s.Proxies,
+		ProxyHeaders:       s.ProxyHeaders,
+		Verify:             s.Verify,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+		Cert:               s.Cert,
+		TLSConfig:          s.TLSConfig,
+		Ja3:                s.Ja3,
+		Ja4:                s.Ja4,
+		MaxRedirects:       s.MaxRedirects,
+		Redirect:           s.Redirect,
+		Retry:              s.Retry,
+		Pool:               s.Pool,
+		Timeouts:           s.Timeouts,
+	}
+	if s.TLSConfig != nil && !secrets {
+		config := *s.TLSConfig
+		config.ClientKey, config.PKCS12, config.PKCS12Password = nil, nil, ""
+		snapshot.TLSConfig = &config
+	}
+	if s.Params != nil {
+		values := s.Params.Values()
+		for _, key := range s.Params.Keys() {
+			snapshot.Params = append(snapshot.Params, SnapshotParam{Key: key, Values: values[key]})
+		}
+	}
+	snapshot.Cookies = s.cookieStore().all()
+	if s.ProxyPool != nil {
+		snapshot.ProxyPool = &SnapshotProxyPool{
+			Proxies:     s.ProxyPool.Proxies(),
+			Strategy:    s.ProxyPool.Strategy,
+			MaxFailures: s.ProxyPool.MaxFailures,
+			Cooldown:    s.ProxyPool.Cooldown,
+		}
+	}
+	if s.TLSExtensions != nil || s.ExtraExtensions != nil {
+		var err error
+		if snapshot.TLSExtensions, err = transport.FromTLSExtensions(s.TLSExtensions, s.ExtraExtensions); err != nil {
+			return nil, fmt.Errorf("snapshot TLSExtensions: %w", err)
+		}
+	}
+	if s.HTTP2Settings != nil {
+		snapshot.HTTP2Settings = transport.FromHTTP2Settings(s.HTTP2Settings)
+	}
+	return json.Marshal(snapshot)
+}
+
+// 根据Snapshot生成的JSON文档新建Session
+func RestoreSession(doc []byte) (*Session, error) {
+	snapshot := &SessionSnapshot{}
+	if err := json.Unmarshal(doc, snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version < 1 || snapshot.Version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported session snapshot version %d", snapshot.Version)
+	}
+	session := &Session{
+		Headers:            snapshot.Headers,
+		Auth:               snapshot.Auth,
+		Proxies:            snapshot.Proxies,
+		ProxyHeaders:       snapshot.ProxyHeaders,
+		Verify:             snapshot.Verify,
+		InsecureSkipVerify: snapshot.InsecureSkipVerify,
+		Cert:               snapshot.Cert,
+		TLSConfig:          snapshot.TLSConfig,
+		Ja3:                snapshot.Ja3,
+		Ja4:                snapshot.Ja4,
+		MaxRedirects:       snapshot.MaxRedirects,
+		Redirect:           snapshot.Redirect,
+		Retry:              snapshot.Retry,
+		Pool:               snapshot.Pool,
+		Timeouts:           snapshot.Timeouts,
+	}
+	if snapshot.Params != nil {
+		session.Params = url.NewParams()
+		for _, param := range snapshot.Params {
+			for _, value := range param.Values {
+				session.Params.Add(param.Key, value)
+			}
+		}
+	}
+	session.Cookies, _ = cookiejar.New(nil)
+	session.cookieStore().set(snapshot.Cookies)
+	if pool := snapshot.ProxyPool; pool != nil {
+		session.ProxyPool = url.NewProxyPool(pool.Proxies...)
+		session.ProxyPool.Strategy = pool.Strategy
+		session.ProxyPool.MaxFailures = pool.MaxFailures
+		session.ProxyPool.Cooldown = pool.Cooldown
+	}
+	var err error
+	if snapshot.TLSExtensions != nil {
+		if session.TLSExtensions, err = transport.ToTLSExtensions(snapshot.TLSExtensions); err != nil {
+			return nil, fmt.Errorf("restore TLSExtensions: %w", err)
+		}
+		if session.ExtraExtensions, err = transport.ToExtraExtensions(snapshot.TLSExtensions); err != nil {
+			return nil, fmt.Errorf("restore TLSExtensions: %w", err)
+		}
+	}
+	if snapshot.HTTP2Settings != nil {
+		if session.HTTP2Settings, err = transport.ToHTTP2Settings(snapshot.HTTP2Settings); err != nil {
+			return nil, fmt.Errorf("restore HTTP2Settings: %w", err)
+		}
+	}
+	return session, nil
+}
@@ -0,0 +1,65 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/url"
+	"testing"
+)
+
+// 快照默认不保存客户端私钥与PKCS#12，SnapshotWithSecrets保存全部
+func TestSnapshotSecrets(t *testing.T) {
+	session := NewSession()
+	session.Auth = []string{"user", "pass"}
+	session.TLSConfig = &url.TLSConfig{
+		ClientKeyFile:  "client.key",
+		ClientCert:     []byte("cert"),
+		ClientKey:      []byte("private key"),
+		PKCS12:         []byte("pkcs12"),
+		PKCS12Password: "pkcs12 password",
+	}
+	if err := session.CookieJar().Set(&http.Cookie{Name: "sid", Value: "1", Domain: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := session.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"private key", "pkcs12", "pkcs12 password"} {
+		// 快照中的[]byte为Base64编码，同时检查明文与编码后的内容
+		if bytes.Contains(doc, []byte(secret)) || bytes.Contains(doc, []byte(base64.StdEncoding.EncodeToString([]byte(secret)))) {
+			t.Errorf("snapshot contains %q", secret)
+		}
+	}
+	if session.TLSConfig.ClientKey == nil || session.TLSConfig.PKCS12Password == "" {
+		t.Fatal("Snapshot modified the session's TLSConfig")
+	}
+	restored, err := RestoreSession(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := restored.TLSConfig
+	if config.ClientKey != nil || config.PKCS12 != nil || config.PKCS12Password != "" {
+		t.Fatalf("restored TLSConfig has secrets: %+v", config)
+	}
+	if config.ClientKeyFile != "client.key" || string(config.ClientCert) != "cert" {
+		t.Fatalf("restored TLSConfig = %+v", config)
+	}
+	if c := restored.CookieJar().Get("sid", "example.com"); c == nil || len(restored.Auth) != 2 {
+		t.Fatalf("restored cookie = %+v, auth = %v", c, restored.Auth)
+	}
+
+	doc, err = session.SnapshotWithSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored, err = RestoreSession(doc); err != nil {
+		t.Fatal(err)
+	}
+	config = restored.TLSConfig
+	if string(config.ClientKey) != "private key" || string(config.PKCS12) != "pkcs12" || config.PKCS12Password != "pkcs12 password" {
+		t.Fatalf("restored TLSConfig = %+v", config)
+	}
+}
@@ -0,0 +1,205 @@
+package requests
+
+import (
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/chttp/httptrace"
+	"io"
+	"net"
+	"sync"
+)
+
+// Session连接池的统计快照
+type SessionStats struct {
+	Hosts       map[string]*HostStats // 以host:port为键，使用http代理访问http地址时为代理地址
+	Open        int                   // 已建立的连接数
+	Idle        int                   // 空闲连接数
+	InUse       int                   // 正在处理请求的连接数
+	Handshakes  int64                 // 已完成的TLS握手次数
+	Resumptions int64                 // 通过会话恢复完成的TLS握手次数
+	H2Streams   int                   // 进行中的HTTP2流数
+}
+
+// 单个主机的连接统计
+type HostStats struct {
+	Open        int
+	Idle        int
+	InUse       int
+	Handshakes  int64
+	Resumptions int64
+	H2Streams   int
+}
+
+// 记录Session建立的连接及握手次数，零值可直接使用
+type connStats struct {
+	mutex       sync.Mutex
+	conns       map[net.Conn]*trackedConn // 以交给chttp的连接为键
+	handshakes  map[string]int64
+	resumptions map[string]int64
+}
+
+// 被统计的底层连接，TLS连接关闭时会关闭底层连接
+type trackedConn struct {
+	net.Conn
+	stats     *connStats
+	host      string
+	key       net.Conn
+	h2        bool
+	active    int // 进行中的请求数，由stats.mutex保护
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stats.mutex.Lock()
+		if c.stats.conns[c.key] == c {
+			delete(c.stats.conns, c.key)
+		}
+		c.stats.mutex.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// 包装新建的底层连接，连接可用后调用register开始统计
+func (cs *connStats) track(conn net.Conn, host string) *trackedConn {
+	return &trackedConn{Conn: conn, stats: cs, host: host}
+}
+
+// 登记已建立的连接，key为交给chttp的连接，tls表示是否完成了TLS握手
+func (cs *connStats) register(c *trackedConn, key net.Conn, tls, resumed, h2 bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.conns == nil {
+		cs.conns = make(map[net.Conn]*trackedConn)
+		cs.handshakes = make(map[string]int64)
+		cs.resumptions = make(map[string]int64)
+	}
+	c.key, c.h2 = key, h2
+	cs.conns[key] = c
+	if tls {
+		cs.handshakes[c.host]++
+	}
+	if resumed {
+		cs.resumptions[c.host]++
+	}
+}
+
+// 连接开始处理请求，返回的函数在请求结束时调用
+func (cs *connStats) acquire(key net.Conn) func() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	c, ok := cs.conns[key]
+	if !ok {
+		return func() {}
+	}
+	c.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cs.mutex.Lock()
+			c.active--
+			cs.mutex.Unlock()
+		})
+	}
+}
+
+// 关闭全部连接，包括正在处理请求的连接
+func (cs *connStats) closeAll() {
+	cs.mutex.Lock()
+	conns := make([]net.Conn, 0, len(cs.conns))
+	for key := range cs.conns {
+		conns = append(conns, key)
+	}
+	cs.mutex.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (cs *connStats) snapshot() *SessionStats {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	stats := &SessionStats{Hosts: make(map[string]*HostStats)}
+	host := func(name string) *HostStats {
+		h, ok := stats.Hosts[name]
+		if !ok {
+			h = &HostStats{}
+			stats.Hosts[name] = h
+		}
+		return h
+	}
+	for _, c := range cs.conns {
+		h := host(c.host)
+		h.Open++
+		if c.active > 0 {
+			h.InUse++
+		} else {
+			h.Idle++
+		}
+		if c.h2 {
+			h.H2Streams += c.active
+		}
+	}
+	for name, n := range cs.handshakes {
+		host(name).Handshakes = n
+	}
+	for name, n := range cs.resumptions {
+		host(name).Resumptions = n
+	}
+	for _, h := range stats.Hosts {
+		stats.Open += h.Open
+		stats.Idle += h.Idle
+		stats.InUse += h.InUse
+		stats.Handshakes += h.Handshakes
+		stats.Resumptions += h.Resumptions
+		stats.H2Streams += h.H2Streams
+	}
+	return stats
+}
+
+// 记录每个请求占用的连接，响应体读取完毕或关闭时释放
+type statsTransport struct {
+	*http.Transport
+	stats *connStats
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var mutex sync.Mutex
+	release := func() {}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			// HTTP2请求在连接失效时会换用新的连接重试
+			mutex.Lock()
+			defer mutex.Unlock()
+			release()
+			release = t.stats.acquire(info.Conn)
+		},
+	}
+	resp, err := t.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	mutex.Lock()
+	defer mutex.Unlock()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// 读到结尾或关闭时释放连接的响应体
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,100 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	url2 "net/url"
+	"time"
+)
+
+// 在上下文中传递本次请求的超时设置，拨号器据此限制建立连接与TLS握手的时间
+type timeoutsKey struct{}
+
+func contextTimeouts(ctx context.Context) url.Timeouts {
+	timeouts, _ := ctx.Value(timeoutsKey{}).(url.Timeouts)
+	return timeouts
+}
+
+// 合并Session与请求中的超时设置，优先级为req.Timeouts、req.Timeout、s.Timeouts
+func (s *Session) timeouts(req *url.Request) url.Timeouts {
+	timeouts := url.Timeouts{}.Merge(s.Timeouts)
+	if req.Timeout != 0 {
+		timeouts.Total = req.Timeout
+	}
+	timeouts = timeouts.Merge(req.Timeouts)
+	if timeouts.Total == 0 {
+		timeouts.Total = DEFAULT_TIMEOUT * time.Second
+	}
+	return timeouts
+}
+
+// 在限定时间内执行fn，超时返回对应阶段的*url.TimeoutError，timeout为0时不限制
+func withTimeout(ctx context.Context, phase url.TimeoutPhase, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, &url.TimeoutError{Phase: phase, Duration: timeout})
+	defer cancel()
+	err := fn(ctx)
+	var timeoutErr *url.TimeoutError
+	if err != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
+
+// 上下文因超时取消时，将错误替换为对应阶段的*url.TimeoutError，保留外层的*url.Error
+func timeoutError(ctx context.Context, err error) error {
+	var timeoutErr *url.TimeoutError
+	if err == nil || errors.As(err, &timeoutErr) || !errors.As(context.Cause(ctx), &timeoutErr) {
+		return err
+	}
+	var urlErr *url2.Error
+	if errors.As(err, &urlErr) {
+		urlErr.Err = timeoutErr
+		return urlErr
+	}
+	return timeoutErr
+}
+
+// 两次读取之间超过timeout时调用expire中断读取
+type idleTimeoutReader struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, expire func()) *idleTimeoutReader {
+	timer := time.AfterFunc(timeout, expire)
+	timer.Stop()
+	return &idleTimeoutReader{ReadCloser: body, timer: timer, timeout: timeout}
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.timeout)
+	n, err := r.ReadCloser.Read(p)
+	r.timer.Stop()
+	return n, err
+}
+
+// 流式响应体，读取错误转换为超时错误，关闭时释放请求的上下文
+type timeoutBody struct {
+	io.ReadCloser
+	ctx   context.Context
+	close func()
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = timeoutError(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	defer b.close()
+	return b.ReadCloser.Close()
+}
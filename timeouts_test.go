@@ -0,0 +1,151 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"github.com/wangluozhe/requests/url"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 接受连接后不发送任何数据，直到测试结束
+func silentListener(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []net.Conn
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	return ln.Addr().String()
+}
+
+// 等待headerDelay后发送响应头与first，再等待bodyDelay后发送second，客户端断开时提前返回
+func slowServer(t *testing.T, headerDelay, bodyDelay time.Duration) *httptest.Server {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		wait := func(d time.Duration) bool {
+			select {
+			case <-time.After(d):
+				return true
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		if !wait(headerDelay) {
+			return
+		}
+		w.Write([]byte("first,"))
+		w.(nethttp.Flusher).Flush()
+		if !wait(bodyDelay) {
+			return
+		}
+		w.Write([]byte("second"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func checkTimeout(t *testing.T, name string, err error, phase url.TimeoutPhase, timeout time.Duration) {
+	t.Helper()
+	var timeoutErr *url.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("%s: err = %v, want *url.TimeoutError", name, err)
+	}
+	if timeoutErr.Phase != phase || timeoutErr.Duration != timeout {
+		t.Fatalf("%s: phase = %q, duration = %s, want %q after %s", name, timeoutErr.Phase, timeoutErr.Duration, phase, timeout)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("%s: errors.Is(err, context.DeadlineExceeded) = false", name)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("%s: err is not a net.Error with Timeout() true", name)
+	}
+}
+
+// 每个阶段超时时返回对应阶段的*url.TimeoutError
+func TestTimeoutPhases(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	silent := silentListener(t)
+	slowHeader := slowServer(t, time.Second, 0)
+	slowBody := slowServer(t, 0, time.Second)
+
+	tests := []struct {
+		name     string
+		url      string
+		timeouts *url.Timeouts
+		proxy    string
+		phase    url.TimeoutPhase
+	}{
+		// 代理不响应CONNECT请求，建立隧道超时
+		{name: "connect", url: "https://example.com/", proxy: "http://" + silent, timeouts: &url.Timeouts{Connect: timeout}, phase: url.TimeoutConnect},
+		{name: "tls handshake", url: "https://" + silent + "/", timeouts: &url.Timeouts{TLSHandshake: timeout}, phase: url.TimeoutTLSHandshake},
+		{name: "response header", url: slowHeader.URL, timeouts: &url.Timeouts{ResponseHeader: timeout}, phase: url.TimeoutResponseHeader},
+		{name: "total before headers", url: slowHeader.URL, timeouts: &url.Timeouts{Total: timeout}, phase: url.TimeoutTotal},
+		{name: "total while reading the body", url: slowBody.URL, timeouts: &url.Timeouts{Total: timeout}, phase: url.TimeoutTotal},
+		{name: "body idle", url: slowBody.URL, timeouts: &url.Timeouts{BodyIdle: timeout}, phase: url.TimeoutBodyIdle},
+	}
+	for _, test := range tests {
+		req := url.NewRequest()
+		req.Timeouts = test.timeouts
+		req.Proxies = test.proxy
+		start := time.Now()
+		_, err := NewSession().Get(test.url, req)
+		checkTimeout(t, test.name, err, test.phase, timeout)
+		if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+			t.Errorf("%s: returned after %s", test.name, elapsed)
+		}
+	}
+
+	// Timeout等同于Timeouts.Total
+	req := url.NewRequest()
+	req.Timeout = timeout
+	_, err := NewSession().Get(slowHeader.URL, req)
+	checkTimeout(t, "Timeout", err, url.TimeoutTotal, timeout)
+}
+
+// 流式响应的总超时在收到响应头后停止，读取响应体只受BodyIdle限制
+func TestTimeoutStream(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	server := slowServer(t, 0, 3*timeout)
+
+	req := url.NewRequest()
+	req.Stream = true
+	req.Timeouts = &url.Timeouts{Total: timeout}
+	r, err := NewSession().Get(server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(r.Body); err != nil || string(content) != "first,second" {
+		t.Fatalf("content = %q, err = %v", content, err)
+	}
+	r.Body.Close()
+
+	req.Timeouts = &url.Timeouts{Total: timeout, BodyIdle: timeout}
+	if r, err = NewSession().Get(server.URL, req); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	_, err = io.ReadAll(r.Body)
+	checkTimeout(t, "stream body idle", err, url.TimeoutBodyIdle, timeout)
+}
@@ -0,0 +1,177 @@
+package requests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	utls "github.com/refraction-networking/utls"
+	"github.com/wangluozhe/requests/url"
+	"golang.org/x/crypto/pkcs12"
+	"io/ioutil"
+	"strings"
+)
+
+// 根据配置生成utls.Config
+func newTLSConfig(key transportKey) (*utls.Config, error) {
+	tlsConfig := &utls.Config{
+		InsecureSkipVerify:     key.insecureSkipVerify,
+		ClientSessionCache:     utls.NewLRUClientSessionCache(0),
+		OmitEmptyPsk:           true,
+		SessionTicketsDisabled: true,
+	}
+
+	// 设置证书，Cert依次为客户端证书、客户端私钥、CA证书，只有指定了CA证书时才替换信任的CA
+	if key.cert != "" {
+		cert := strings.Split(key.cert, "\x00")
+		if len(cert) < 2 {
+			return nil, errors.New("cert requires a certificate and a key file")
+		}
+		certs, err := utls.LoadX509KeyPair(cert[0], cert[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(cert) == 3 {
+			cert_byte, err := ioutil.ReadFile(cert[2])
+			if err != nil {
+				return nil, err
+			}
+			certPool := x509.NewCertPool()
+			if !certPool.AppendCertsFromPEM(cert_byte) {
+				return nil, errors.New("failed to parse root certificate")
+			}
+			tlsConfig.RootCAs = certPool
+		}
+		tlsConfig.Certificates = []utls.Certificate{certs}
+	}
+
+	c := key.tlsConfig
+	if c == nil {
+		return tlsConfig, nil
+	}
+	if c.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	tlsConfig.ServerName = c.ServerName
+
+	// CA证书
+	if c.RootCAFile != "" || c.RootCAs != nil {
+		certPool := x509.NewCertPool()
+		if c.UseSystemRoots {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, err
+			}
+			certPool = systemPool
+		}
+		if c.RootCAFile != "" {
+			content, err := ioutil.ReadFile(c.RootCAFile)
+			if err != nil {
+				return nil, err
+			}
+			if !certPool.AppendCertsFromPEM(content) {
+				return nil, fmt.Errorf("failed to parse root certificate %s", c.RootCAFile)
+			}
+		}
+		if c.RootCAs != nil && !certPool.AppendCertsFromPEM(c.RootCAs) {
+			return nil, errors.New("failed to parse root certificate")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	// 客户端证书
+	certificates, err := loadClientCertificates(c)
+	if err != nil {
+		return nil, err
+	}
+	if certificates != nil {
+		tlsConfig.Certificates = certificates
+	}
+
+	// 证书公钥固定在VerifyConnection中校验，会话恢复时同样生效
+	if len(c.PinnedSPKI) != 0 {
+		pins := make(map[string]bool, len(c.PinnedSPKI))
+		for _, pin := range c.PinnedSPKI {
+			pins[strings.TrimPrefix(pin, "sha256/")] = true
+		}
+		tlsConfig.VerifyConnection = func(state utls.ConnectionState) error {
+			for _, cert := range state.PeerCertificates {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+					return nil
+				}
+			}
+			return &utls.CertificateVerificationError{
+				UnverifiedCertificates: state.PeerCertificates,
+				Err:                    errors.New("no certificate in the chain matches the pinned public keys"),
+			}
+		}
+	}
+	tlsConfig.VerifyPeerCertificate = c.VerifyPeerCertificate
+	return tlsConfig, nil
+}
+
+// 加载客户端证书，PEM与PKCS#12同时设置时使用PEM
+func loadClientCertificates(c *url.TLSConfig) ([]utls.Certificate, error) {
+	var err error
+	certPEM, keyPEM := c.ClientCert, c.ClientKey
+	if c.ClientCertFile != "" {
+		if certPEM, err = ioutil.ReadFile(c.ClientCertFile); err != nil {
+			return nil, err
+		}
+	}
+	if c.ClientKeyFile != "" {
+		if keyPEM, err = ioutil.ReadFile(c.ClientKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if certPEM == nil && keyPEM == nil {
+		p12 := c.PKCS12
+		if c.PKCS12File != "" {
+			if p12, err = ioutil.ReadFile(c.PKCS12File); err != nil {
+				return nil, err
+			}
+		}
+		if p12 == nil {
+			return nil, nil
+		}
+		certPEM, keyPEM, err = decodePKCS12(p12, c.PKCS12Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if keyPEM == nil {
+		// 证书与私钥可以放在同一个PEM中
+		keyPEM = certPEM
+	}
+	cert, err := utls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return []utls.Certificate{cert}, nil
+}
+
+// 将PKCS#12转换为PEM格式的证书链与私钥
+func decodePKCS12(p12 []byte, password string) ([]byte, []byte, error) {
+	blocks, err := pkcs12.ToPEM(p12, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode PKCS#12: %w", err)
+	}
+	var certPEM, keyPEM bytes.Buffer
+	for _, block := range blocks {
+		// 去掉PKCS#12中的属性，否则部分解析器无法识别
+		block = &pem.Block{Type: block.Type, Bytes: block.Bytes}
+		if block.Type == "CERTIFICATE" {
+			pem.Encode(&certPEM, block)
+		} else {
+			pem.Encode(&keyPEM, block)
+		}
+	}
+	if certPEM.Len() == 0 || keyPEM.Len() == 0 {
+		return nil, nil, errors.New("PKCS#12 does not contain a certificate and a private key")
+	}
+	return certPEM.Bytes(), keyPEM.Bytes(), nil
+}
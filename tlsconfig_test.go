@@ -0,0 +1,89 @@
+package requests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/wangluozhe/requests/url"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 生成自签名证书与私钥文件
+func writeCertPair(t *testing.T, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// Cert只有证书与私钥时不替换信任的CA，第三个路径为CA证书
+func TestCertRootCAs(t *testing.T) {
+	certFile, keyFile := writeCertPair(t, "client")
+	config, err := newTLSConfig(transportKey{cert: strings.Join([]string{certFile, keyFile}, "\x00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs != nil {
+		t.Fatal("client certificate was used as root CA")
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("certificates = %d, want 1", len(config.Certificates))
+	}
+
+	caFile, _ := writeCertPair(t, "ca")
+	config, err = newTLSConfig(transportKey{cert: strings.Join([]string{certFile, keyFile, caFile}, "\x00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil {
+		t.Fatal("root CA from Cert[2] was not set")
+	}
+}
+
+// session.Verify为false时跳过证书校验，请求的Verify不参与判断
+func TestVerify(t *testing.T) {
+	server, _ := newTestServer(t)
+	session := NewSession()
+	defer session.Close()
+	if _, err := session.Get(server.URL, nil); err == nil {
+		t.Fatal("request to untrusted server succeeded")
+	}
+	req := url.NewRequest()
+	req.Verify = false
+	if _, err := session.Get(server.URL, req); err == nil {
+		t.Fatal("request Verify=false skipped verification")
+	}
+	session.Verify = false
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package requests
+
+import (
+	"context"
+	utls "github.com/refraction-networking/utls"
+	"github.com/wangluozhe/chttp/httptrace"
+	"github.com/wangluozhe/requests/models"
+	"github.com/wangluozhe/requests/url"
+	"net"
+	nethttptrace "net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// 通过httptrace记录一次请求的连接与耗时，钩子可能在拨号的goroutine中调用
+type traceRecorder struct {
+	mutex        sync.Mutex
+	trace        models.Trace
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	tlsDone      bool
+}
+
+func (r *traceRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		// 每次重定向都会重新获取连接
+		GetConn: func(string) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.trace = models.Trace{Start: time.Now()}
+			r.dnsStart, r.connectStart, r.tlsStart, r.tlsDone = time.Time{}, time.Time{}, time.Time{}, false
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if !r.dnsStart.IsZero() {
+				r.trace.DNSLookup = time.Since(r.dnsStart)
+			}
+			r.trace.Addrs = nil
+			for _, addr := range info.Addrs {
+				r.trace.Addrs = append(r.trace.Addrs, addr.String())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if err == nil && !r.connectStart.IsZero() {
+				r.trace.Connect = time.Since(r.connectStart)
+				// 拨号器在ConnectStart之后才解析域名，扣除DNS解析的耗时
+				if r.dnsStart.After(r.connectStart) {
+					r.trace.Connect -= r.trace.DNSLookup
+				}
+			}
+		},
+		// 自定义拨号器完成握手后chttp会再次触发握手钩子，只记录第一次
+		TLSHandshakeStart: func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if r.tlsStart.IsZero() {
+				r.tlsStart = time.Now()
+			}
+		},
+		TLSHandshakeDone: func(state utls.ConnectionState, err error) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			if r.tlsDone || r.tlsStart.IsZero() {
+				return
+			}
+			r.tlsDone = true
+			r.trace.TLSHandshake = time.Since(r.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.trace.GetConn = time.Since(r.trace.Start)
+			r.trace.Reused, r.trace.WasIdle, r.trace.IdleTime = info.Reused, info.WasIdle, info.IdleTime
+			r.trace.RemoteAddr = info.Conn.RemoteAddr().String()
+			if tlsConn, ok := info.Conn.(*utls.UConn); ok {
+				state := tlsConn.ConnectionState()
+				r.trace.TLSVersion = utls.VersionName(state.Version)
+				r.trace.CipherSuite = utls.CipherSuiteName(state.CipherSuite)
+				r.trace.NegotiatedProtocol = state.NegotiatedProtocol
+				r.trace.DidResume = state.DidResume
+			}
+		},
+		GotFirstResponseByte: func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.trace.TimeToFirstByte = time.Since(r.trace.Start)
+		},
+	}
+}
+
+// 获取当前记录的副本
+func (r *traceRecorder) snapshot() *models.Trace {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	trace := r.trace
+	trace.Addrs = append([]string(nil), r.trace.Addrs...)
+	return &trace
+}
+
+// chttp的httptrace不会被net包识别，将DNS钩子转交给net包，使net.Dialer的域名解析触发DNSStart与DNSDone
+func withDNSTrace(ctx context.Context, trace *httptrace.ClientTrace) context.Context {
+	if trace == nil || (trace.DNSStart == nil && trace.DNSDone == nil) {
+		return ctx
+	}
+	return nethttptrace.WithClientTrace(ctx, &nethttptrace.ClientTrace{
+		DNSStart: func(info nethttptrace.DNSStartInfo) {
+			if trace.DNSStart != nil {
+				trace.DNSStart(httptrace.DNSStartInfo{Host: info.Host})
+			}
+		},
+		DNSDone: func(info nethttptrace.DNSDoneInfo) {
+			if trace.DNSDone != nil {
+				trace.DNSDone(httptrace.DNSDoneInfo{Addrs: info.Addrs, Err: info.Err, Coalesced: info.Coalesced})
+			}
+		},
+	})
+}
+
+// 建立连接并触发ConnectStart与ConnectDone，使用代理时包含建立隧道的时间，受Timeouts.Connect限制
+func traceConnect(ctx context.Context, network, addr string, dial func(context.Context) (net.Conn, error)) (net.Conn, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	ctx = withDNSTrace(ctx, trace)
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart(network, addr)
+	}
+	var conn net.Conn
+	err := withTimeout(ctx, url.TimeoutConnect, contextTimeouts(ctx).Connect, func(ctx context.Context) error {
+		var err error
+		conn, err = dial(ctx)
+		return err
+	})
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone(network, addr, err)
+	}
+	return conn, err
+}
@@ -0,0 +1,67 @@
+package requests
+
+import (
+	utls "github.com/refraction-networking/utls"
+	"github.com/wangluozhe/requests/url"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 首个请求记录DNS解析、建立连接、TLS握手与首字节的耗时，复用连接的请求不再记录连接阶段
+func TestTrace(t *testing.T) {
+	server := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	// 使用域名触发DNS解析
+	rawurl := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	session := NewSession()
+	req := url.NewRequest()
+	req.InsecureSkipVerify = true
+
+	r, err := session.Get(rawurl, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := r.Trace
+	if trace == nil {
+		t.Fatal("response has no trace")
+	}
+	if trace.Start.IsZero() || trace.DNSLookup <= 0 || len(trace.Addrs) == 0 || trace.Connect <= 0 || trace.TLSHandshake <= 0 {
+		t.Fatalf("connection phases not recorded: %+v", trace)
+	}
+	// 各阶段依次进行，获取连接的总耗时不小于各阶段之和，首字节在获取连接之后
+	if trace.GetConn < trace.DNSLookup+trace.Connect+trace.TLSHandshake {
+		t.Errorf("GetConn %s < DNSLookup %s + Connect %s + TLSHandshake %s", trace.GetConn, trace.DNSLookup, trace.Connect, trace.TLSHandshake)
+	}
+	if trace.TimeToFirstByte < trace.GetConn+10*time.Millisecond || r.Elapsed < trace.TimeToFirstByte {
+		t.Errorf("GetConn = %s, TimeToFirstByte = %s, Elapsed = %s", trace.GetConn, trace.TimeToFirstByte, r.Elapsed)
+	}
+	if trace.Reused || trace.WasIdle {
+		t.Errorf("first request: Reused = %v, WasIdle = %v", trace.Reused, trace.WasIdle)
+	}
+	if trace.TLSVersion != "TLS 1.3" || trace.CipherSuite != utls.CipherSuiteName(r.TLS.CipherSuite) || trace.NegotiatedProtocol != r.TLS.NegotiatedProtocol {
+		t.Errorf("TLSVersion = %q, CipherSuite = %q, NegotiatedProtocol = %q", trace.TLSVersion, trace.CipherSuite, trace.NegotiatedProtocol)
+	}
+	if trace.RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("RemoteAddr = %q, want %q", trace.RemoteAddr, server.Listener.Addr())
+	}
+
+	if r, err = session.Get(rawurl, req); err != nil {
+		t.Fatal(err)
+	}
+	trace = r.Trace
+	if !trace.Reused || !trace.WasIdle {
+		t.Errorf("second request: Reused = %v, WasIdle = %v", trace.Reused, trace.WasIdle)
+	}
+	if trace.DNSLookup != 0 || len(trace.Addrs) != 0 || trace.Connect != 0 || trace.TLSHandshake != 0 {
+		t.Errorf("reused connection recorded connection phases: %+v", trace)
+	}
+	if trace.TimeToFirstByte < 10*time.Millisecond || trace.TLSVersion != "TLS 1.3" {
+		t.Errorf("second request: TimeToFirstByte = %s, TLSVersion = %q", trace.TimeToFirstByte, trace.TLSVersion)
+	}
+}
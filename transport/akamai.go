@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var pseudoHeaders = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// 解析Akamai HTTP2指纹，格式为"SETTINGS|WINDOW_UPDATE|PRIORITY|伪头部顺序"，
+// 如"1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"。
+// WINDOW_UPDATE为00时不发送连接级WINDOW_UPDATE，PRIORITY为0时不发送PRIORITY帧
+func ParseAkamaiFingerprint(fingerprint string) (*H2Settings, error) {
+	parts := strings.Split(fingerprint, "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid Akamai fingerprint %q: expected 4 sections separated by |", fingerprint)
+	}
+	h2Settings := &H2Settings{Settings: map[string]int{}, SettingsOrder: []string{}}
+
+	if parts[0] != "" {
+		for _, field := range strings.Split(parts[0], ";") {
+			id, val, ok := strings.Cut(field, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: setting %q is not in id:value form", fingerprint, field)
+			}
+			settingID, err := strconv.ParseUint(id, 10, 16)
+			if err != nil || settingID == 0 {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: invalid setting id %q", fingerprint, id)
+			}
+			settingVal, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: invalid value %q for setting %s", fingerprint, val, id)
+			}
+			name := settingName(uint16(settingID))
+			if _, ok := h2Settings.Settings[name]; ok {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: duplicate setting %s", fingerprint, id)
+			}
+			h2Settings.Settings[name] = int(settingVal)
+			h2Settings.SettingsOrder = append(h2Settings.SettingsOrder, name)
+		}
+	}
+
+	if parts[1] != "00" {
+		windowUpdate, err := strconv.ParseUint(parts[1], 10, 31)
+		if err != nil || windowUpdate == 0 {
+			return nil, fmt.Errorf("invalid Akamai fingerprint %q: invalid window update %q", fingerprint, parts[1])
+		}
+		h2Settings.ConnectionFlow = int(windowUpdate)
+	}
+
+	if parts[2] != "0" {
+		for _, field := range strings.Split(parts[2], ",") {
+			values := strings.Split(field, ":")
+			if len(values) != 4 {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: priority frame %q is not in streamID:exclusive:streamDep:weight form", fingerprint, field)
+			}
+			streamID, err1 := strconv.ParseUint(values[0], 10, 31)
+			streamDep, err2 := strconv.ParseUint(values[2], 10, 31)
+			weight, err3 := strconv.Atoi(values[3])
+			if err1 != nil || err2 != nil || err3 != nil || streamID == 0 || weight < 1 || weight > 256 || values[1] != "0" && values[1] != "1" {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: invalid priority frame %q", fingerprint, field)
+			}
+			h2Settings.PriorityFrames = append(h2Settings.PriorityFrames, map[string]interface{}{
+				"streamID": int(streamID),
+				"priorityParam": map[string]interface{}{
+					"weight":    weight,
+					"streamDep": int(streamDep),
+					"exclusive": values[1] == "1",
+				},
+			})
+		}
+	}
+
+	if parts[3] != "" {
+		for _, field := range strings.Split(parts[3], ",") {
+			header, ok := pseudoHeaders[field]
+			if !ok {
+				return nil, fmt.Errorf("invalid Akamai fingerprint %q: unknown pseudo header %q", fingerprint, field)
+			}
+			for _, h := range h2Settings.PseudoHeaderOrder {
+				if h == header {
+					return nil, fmt.Errorf("invalid Akamai fingerprint %q: duplicate pseudo header %q", fingerprint, field)
+				}
+			}
+			h2Settings.PseudoHeaderOrder = append(h2Settings.PseudoHeaderOrder, header)
+		}
+	}
+	return h2Settings, nil
+}
+
+// 生成Akamai HTTP2指纹，与ParseAkamaiFingerprint互为逆操作，未设置SettingsOrder时按设置ID排序
+func (h2Settings *H2Settings) AkamaiFingerprint() string {
+	order := h2Settings.SettingsOrder
+	if order == nil {
+		for name := range h2Settings.Settings {
+			order = append(order, name)
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return covertSettingNameToID(order[i]) < covertSettingNameToID(order[j])
+		})
+	}
+	var settings []string
+	for _, name := range order {
+		if val, ok := h2Settings.Settings[name]; ok {
+			settings = append(settings, fmt.Sprintf("%d:%d", covertSettingNameToID(name), val))
+		}
+	}
+
+	windowUpdate := "00"
+	if h2Settings.ConnectionFlow != 0 {
+		windowUpdate = strconv.Itoa(h2Settings.ConnectionFlow)
+	}
+
+	priority := "0"
+	if len(h2Settings.PriorityFrames) > 0 {
+		var frames []string
+		for _, frame := range h2Settings.PriorityFrames {
+			param, _ := frame["priorityParam"].(map[string]interface{})
+			exclusive := 0
+			if e, _ := param["exclusive"].(bool); e {
+				exclusive = 1
+			}
+			frames = append(frames, fmt.Sprintf("%d:%d:%d:%d", toInt(frame["streamID"]), exclusive, toInt(param["streamDep"]), toInt(param["weight"])))
+		}
+		priority = strings.Join(frames, ",")
+	}
+
+	var pseudo []string
+	for _, header := range h2Settings.PseudoHeaderOrder {
+		if len(header) > 1 {
+			pseudo = append(pseudo, header[1:2])
+		}
+	}
+	return strings.Join([]string{strings.Join(settings, ";"), windowUpdate, priority, strings.Join(pseudo, ",")}, "|")
+}
+
+// 设置ID对应的名称，未知设置使用UNKNOWN_SETTING_前缀
+func settingName(id uint16) string {
+	for name, settingID := range settings {
+		if uint16(settingID) == id {
+			return name
+		}
+	}
+	return "UNKNOWN_SETTING_" + strconv.Itoa(int(id))
+}
+
+// JSON解析得到的数值为float64
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
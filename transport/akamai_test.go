@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAkamaiFingerprint(t *testing.T) {
+	h2Settings, err := ParseAkamaiFingerprint("1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &H2Settings{
+		Settings: map[string]int{
+			"HEADER_TABLE_SIZE":    65536,
+			"ENABLE_PUSH":          0,
+			"INITIAL_WINDOW_SIZE":  6291456,
+			"MAX_HEADER_LIST_SIZE": 262144,
+		},
+		SettingsOrder:     []string{"HEADER_TABLE_SIZE", "ENABLE_PUSH", "INITIAL_WINDOW_SIZE", "MAX_HEADER_LIST_SIZE"},
+		ConnectionFlow:    15663105,
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	}
+	if !reflect.DeepEqual(h2Settings, want) {
+		t.Fatalf("ParseAkamaiFingerprint = %+v, want %+v", h2Settings, want)
+	}
+	if _, err = ToHTTP2SettingsStrict(h2Settings); err != nil {
+		t.Fatalf("parsed settings cannot be converted: %v", err)
+	}
+
+	h2Settings, err = ParseAkamaiFingerprint("1:65536;4:131072;5:16384|12517377|3:0:0:201,5:1:3:101|m,p,a,s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := []map[string]interface{}{
+		{"streamID": 3, "priorityParam": map[string]interface{}{"weight": 201, "streamDep": 0, "exclusive": false}},
+		{"streamID": 5, "priorityParam": map[string]interface{}{"weight": 101, "streamDep": 3, "exclusive": true}},
+	}
+	if !reflect.DeepEqual(h2Settings.PriorityFrames, frames) {
+		t.Fatalf("PriorityFrames = %v, want %v", h2Settings.PriorityFrames, frames)
+	}
+}
+
+// 解析后再生成的指纹与原字符串相同
+func TestAkamaiFingerprintRoundTrip(t *testing.T) {
+	for _, fingerprint := range []string{
+		"1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p",
+		"1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s",
+		"4:2097152;3:100;9:1|10485760|0|m,s,p,a",
+		"8:1;1:4096|00|0|",
+		"|00|0|",
+	} {
+		h2Settings, err := ParseAkamaiFingerprint(fingerprint)
+		if err != nil {
+			t.Errorf("ParseAkamaiFingerprint(%q): %v", fingerprint, err)
+			continue
+		}
+		if got := h2Settings.AkamaiFingerprint(); got != fingerprint {
+			t.Errorf("round trip of %q = %q", fingerprint, got)
+		}
+	}
+
+	// 未设置SettingsOrder时按设置ID排序
+	h2Settings := &H2Settings{Settings: map[string]int{"MAX_HEADER_LIST_SIZE": 262144, "HEADER_TABLE_SIZE": 65536, "ENABLE_PUSH": 0}}
+	if got, want := h2Settings.AkamaiFingerprint(), "1:65536;2:0;6:262144|00|0|"; got != want {
+		t.Errorf("AkamaiFingerprint = %q, want %q", got, want)
+	}
+}
+
+func TestParseAkamaiFingerprintErrors(t *testing.T) {
+	for fingerprint, want := range map[string]string{
+		"":                                "expected 4 sections",
+		"1:65536|15663105|0":              "expected 4 sections",
+		"1:65536|15663105|0|m,a,s,p|x":    "expected 4 sections",
+		"1=65536|15663105|0|m,a,s,p":      "not in id:value form",
+		"0:1|15663105|0|m,a,s,p":          "invalid setting id",
+		"x:1|15663105|0|m,a,s,p":          "invalid setting id",
+		"70000:1|15663105|0|m,a,s,p":      "invalid setting id",
+		"1:-1|15663105|0|m,a,s,p":         "invalid value",
+		"1:4294967296|15663105|0|m,a,s,p": "invalid value",
+		"1:1;1:2|15663105|0|m,a,s,p":      "duplicate setting",
+		"1:65536|0|0|m,a,s,p":             "invalid window update",
+		"1:65536|2147483648|0|m,a,s,p":    "invalid window update",
+		"1:65536||0|m,a,s,p":              "invalid window update",
+		"1:65536|00|3:0:0|m,a,s,p":        "streamID:exclusive:streamDep:weight",
+		"1:65536|00|0:0:0:201|m,a,s,p":    "invalid priority frame",
+		"1:65536|00|3:2:0:201|m,a,s,p":    "invalid priority frame",
+		"1:65536|00|3:0:0:0|m,a,s,p":      "invalid priority frame",
+		"1:65536|00|3:0:0:257|m,a,s,p":    "invalid priority frame",
+		"1:65536|00|0|m,a,x,p":            "unknown pseudo header",
+		"1:65536|00|0|m,a,m,p":            "duplicate pseudo header",
+		"1:65536|00|0|m,a,,p":             "unknown pseudo header",
+	} {
+		_, err := ParseAkamaiFingerprint(fingerprint)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseAkamaiFingerprint(%q) error = %v, want %q", fingerprint, err, want)
+		}
+	}
+}
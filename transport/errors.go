@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownValue = errors.New("unknown value")                        // 名称无法识别且不是合法的数值
+	ErrOutOfRange   = errors.New("value out of range")                   // 数值超出字段允许的范围
+	ErrInvalidType  = errors.New("invalid type")                         // JSON中的值类型不正确
+	ErrMissingField = errors.New("missing field")                        // 缺少必需的字段
+	ErrUnfaithful   = errors.New("cannot be emitted faithfully by utls") // 严格模式下拒绝的值
+)
+
+// 转换TLS扩展或HTTP2设置时字段值无效，可用errors.Is判断具体原因
+type FieldError struct {
+	Field string      // 字段路径，如SupportedVersions[1]
+	Value interface{} // 无效的值
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v %q", e.Field, e.Err, fmt.Sprint(e.Value))
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func fieldError(field string, index int, value interface{}, err error) *FieldError {
+	if index >= 0 {
+		field = fmt.Sprintf("%s[%d]", field, index)
+	}
+	return &FieldError{Field: field, Value: value, Err: err}
+}
@@ -156,107 +156,271 @@ type Extensions struct {
 	KeyShareCurves []string `json:"KeyShareCurves"`
 	//default is false, default is used grease, if not used grease the NotUsedGREASE param is true
 	NotUsedGREASE bool `json:"NotUsedGREASE"`
+	// ALPN协议列表，如["h2", "http/1.1"]，为空时使用JA3生成的默认值
+	ALPN []string `json:"ALPN"`
+	// ALPS(application_settings)协议列表，默认为["h2"]
+	ALPS []string `json:"ALPS"`
+	// ECH GREASE(65037)参数，JA3中包含65037时生效
+	ECH *ECHGrease `json:"ECH"`
+	//boring: BoringSSL填充方式(默认)
+	//none: 不发送padding扩展
+	//数字: 固定填充长度
+	Padding string `json:"Padding"`
+	// 在末尾添加pre_shared_key(41)并开启会话恢复，首次连接没有会话时不发送
+	PreSharedKey bool `json:"PreSharedKey"`
+	// 每次握手按Chrome的规则随机排列扩展顺序
+	RandomExtensionOrder bool `json:"RandomExtensionOrder"`
+	// 将JA3中的status_request_v2(17)生成为带OCSP请求的完整扩展，默认发送空的17扩展
+	StatusRequestV2 bool `json:"StatusRequestV2"`
 }
 
-func ToTLSExtensions(e *Extensions) (extensions *http.TLSExtensions) {
-	extensions = &http.TLSExtensions{}
+// 严格模式下允许的签名算法，utls可以完成校验
+var faithfulSignatureAlgorithms = map[utls.SignatureScheme]bool{
+	utls.PKCS1WithSHA256:        true,
+	utls.PKCS1WithSHA384:        true,
+	utls.PKCS1WithSHA512:        true,
+	utls.PSSWithSHA256:          true,
+	utls.PSSWithSHA384:          true,
+	utls.PSSWithSHA512:          true,
+	utls.ECDSAWithP256AndSHA256: true,
+	utls.ECDSAWithP384AndSHA384: true,
+	utls.ECDSAWithP521AndSHA512: true,
+	utls.Ed25519:                true,
+	utls.PKCS1WithSHA1:          true,
+	utls.ECDSAWithSHA1:          true,
+}
+
+// 严格模式下允许的KeyShare曲线，utls可以生成真实的密钥
+var faithfulKeyShareCurves = map[utls.CurveID]bool{
+	utls.CurveID(utls.GREASE_PLACEHOLDER): true,
+	utls.CurveP256:                        true,
+	utls.CurveP384:                        true,
+	utls.CurveP521:                        true,
+	utls.X25519:                           true,
+	utls.X25519MLKEM768:                   true,
+	utls.X25519Kyber768Draft00:            true,
+}
+
+// 转换TLS扩展，名称无法识别或数值超出范围时返回*FieldError。
+// ALPN、ALPS、ECH、Padding等额外设置不包含在返回值中，需用ToExtraExtensions转换后设置到ExtraExtensions
+func ToTLSExtensions(e *Extensions) (*http.TLSExtensions, error) {
+	return toTLSExtensions(e, false)
+}
+
+// 严格模式转换TLS扩展，额外拒绝utls无法按原样发送的值：
+// 无法校验的签名算法、无法生成密钥的KeyShare曲线、超出RFC 8449范围的RecordSizeLimit
+func ToTLSExtensionsStrict(e *Extensions) (*http.TLSExtensions, error) {
+	return toTLSExtensions(e, true)
+}
+
+func toTLSExtensions(e *Extensions, strict bool) (*http.TLSExtensions, error) {
+	extensions := &http.TLSExtensions{}
 	if e == nil {
-		return extensions
+		return extensions, nil
 	}
+	mutex.RLock()
+	defer mutex.RUnlock()
 	if e.SupportedSignatureAlgorithms != nil {
-		extensions.SupportedSignatureAlgorithms = &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{}}
-		mutex.RLock()
-		for _, s := range e.SupportedSignatureAlgorithms {
-			var signature_algorithms utls.SignatureScheme
-			if val, ok := supportedSignatureAlgorithmsExtensions[s]; ok {
-				signature_algorithms = val
-			} else {
-				hexInt, _ := strconv.ParseInt(s, 0, 0)
-				signature_algorithms = utls.SignatureScheme(hexInt)
-			}
-			extensions.SupportedSignatureAlgorithms.SupportedSignatureAlgorithms = append(extensions.SupportedSignatureAlgorithms.SupportedSignatureAlgorithms, signature_algorithms)
+		algorithms, err := toSignatureSchemes("SupportedSignatureAlgorithms", e.SupportedSignatureAlgorithms, strict)
+		if err != nil {
+			return nil, err
 		}
-		mutex.RUnlock()
+		extensions.SupportedSignatureAlgorithms = &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: algorithms}
 	}
 	if e.CertCompressionAlgo != nil {
 		extensions.CertCompressionAlgo = &utls.UtlsCompressCertExtension{Algorithms: []utls.CertCompressionAlgo{}}
-		mutex.RLock()
-		for _, s := range e.CertCompressionAlgo {
-			extensions.CertCompressionAlgo.Algorithms = append(extensions.CertCompressionAlgo.Algorithms, certCompressionAlgoExtensions[s])
+		for i, s := range e.CertCompressionAlgo {
+			algorithm, ok := certCompressionAlgoExtensions[s]
+			if !ok {
+				return nil, fieldError("CertCompressionAlgo", i, s, ErrUnknownValue)
+			}
+			extensions.CertCompressionAlgo.Algorithms = append(extensions.CertCompressionAlgo.Algorithms, algorithm)
 		}
-		mutex.RUnlock()
 	}
 	if e.RecordSizeLimit != 0 {
-		hexStr := fmt.Sprintf("0x%v", e.RecordSizeLimit)
-		hexInt, _ := strconv.ParseInt(hexStr, 0, 0)
-		extensions.RecordSizeLimit = &utls.FakeRecordSizeLimitExtension{uint16(hexInt)}
+		// RecordSizeLimit按十六进制书写，如4001表示0x4001
+		limit, err := strconv.ParseUint(strconv.Itoa(e.RecordSizeLimit), 16, 16)
+		if err != nil {
+			return nil, fieldError("RecordSizeLimit", -1, e.RecordSizeLimit, ErrOutOfRange)
+		}
+		if strict && (limit < 64 || limit > 0x4001) {
+			return nil, fieldError("RecordSizeLimit", -1, e.RecordSizeLimit, ErrUnfaithful)
+		}
+		extensions.RecordSizeLimit = &utls.FakeRecordSizeLimitExtension{Limit: uint16(limit)}
 	}
 	if e.DelegatedCredentials != nil {
-		extensions.DelegatedCredentials = &utls.DelegatedCredentialsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{}}
-		mutex.RLock()
-		for _, s := range e.DelegatedCredentials {
-			var signature_algorithms utls.SignatureScheme
-			if val, ok := supportedSignatureAlgorithmsExtensions[s]; ok {
-				signature_algorithms = val
-			} else {
-				hexStr := fmt.Sprintf("0x%v", e.RecordSizeLimit)
-				hexInt, _ := strconv.ParseInt(hexStr, 0, 0)
-				signature_algorithms = utls.SignatureScheme(hexInt)
-			}
-			extensions.DelegatedCredentials.SupportedSignatureAlgorithms = append(extensions.DelegatedCredentials.SupportedSignatureAlgorithms, signature_algorithms)
+		algorithms, err := toSignatureSchemes("DelegatedCredentials", e.DelegatedCredentials, strict)
+		if err != nil {
+			return nil, err
 		}
-		mutex.RUnlock()
+		extensions.DelegatedCredentials = &utls.DelegatedCredentialsExtension{SupportedSignatureAlgorithms: algorithms}
 	}
 	if e.SupportedVersions != nil {
 		extensions.SupportedVersions = &utls.SupportedVersionsExtension{Versions: []uint16{}}
-		mutex.RLock()
-		for _, s := range e.SupportedVersions {
-			extensions.SupportedVersions.Versions = append(extensions.SupportedVersions.Versions, supportedVersionsExtensions[s])
+		for i, s := range e.SupportedVersions {
+			version, ok := supportedVersionsExtensions[s]
+			if !ok {
+				return nil, fieldError("SupportedVersions", i, s, ErrUnknownValue)
+			}
+			extensions.SupportedVersions.Versions = append(extensions.SupportedVersions.Versions, version)
 		}
-		mutex.RUnlock()
 	}
 	if e.PSKKeyExchangeModes != nil {
 		extensions.PSKKeyExchangeModes = &utls.PSKKeyExchangeModesExtension{Modes: []uint8{}}
-		mutex.RLock()
-		for _, s := range e.PSKKeyExchangeModes {
-			extensions.PSKKeyExchangeModes.Modes = append(extensions.PSKKeyExchangeModes.Modes, pskKeyExchangeModesExtensions[s])
+		for i, s := range e.PSKKeyExchangeModes {
+			mode, ok := pskKeyExchangeModesExtensions[s]
+			if !ok {
+				return nil, fieldError("PSKKeyExchangeModes", i, s, ErrUnknownValue)
+			}
+			extensions.PSKKeyExchangeModes.Modes = append(extensions.PSKKeyExchangeModes.Modes, mode)
 		}
-		mutex.RUnlock()
 	}
 	if e.SignatureAlgorithmsCert != nil {
-		extensions.SignatureAlgorithmsCert = &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{}}
-		mutex.RLock()
-		for _, s := range e.SignatureAlgorithmsCert {
-			var signature_algorithms_cert utls.SignatureScheme
-			if val, ok := supportedSignatureAlgorithmsExtensions[s]; ok {
-				signature_algorithms_cert = val
-			} else {
-				hexStr := fmt.Sprintf("0x%v", e.RecordSizeLimit)
-				hexInt, _ := strconv.ParseInt(hexStr, 0, 0)
-				signature_algorithms_cert = utls.SignatureScheme(hexInt)
-			}
-			extensions.SignatureAlgorithmsCert.SupportedSignatureAlgorithms = append(extensions.SignatureAlgorithmsCert.SupportedSignatureAlgorithms, signature_algorithms_cert)
+		algorithms, err := toSignatureSchemes("SignatureAlgorithmsCert", e.SignatureAlgorithmsCert, strict)
+		if err != nil {
+			return nil, err
 		}
-		mutex.RUnlock()
+		extensions.SignatureAlgorithmsCert = &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: algorithms}
 	}
 	if e.KeyShareCurves != nil {
 		extensions.KeyShareCurves = &utls.KeyShareExtension{KeyShares: []utls.KeyShare{}}
-		mutex.RLock()
-		for _, s := range e.KeyShareCurves {
-			if val, ok := keyShareCurvesExtensions[s]; ok {
-				extensions.KeyShareCurves.KeyShares = append(extensions.KeyShareCurves.KeyShares, val)
-			} else {
-				curveID, err := strconv.ParseInt(s, 10, 16)
+		for i, s := range e.KeyShareCurves {
+			keyShare, ok := keyShareCurvesExtensions[s]
+			if !ok {
+				curveID, err := strconv.ParseUint(s, 10, 16)
 				if err != nil {
-					continue
+					return nil, fieldError("KeyShareCurves", i, s, ErrUnknownValue)
 				}
-				extensions.KeyShareCurves.KeyShares = append(extensions.KeyShareCurves.KeyShares, utls.KeyShare{Group: utls.CurveID(curveID), Data: []byte{0}})
+				keyShare = utls.KeyShare{Group: utls.CurveID(curveID), Data: []byte{0}}
 			}
+			if strict && !faithfulKeyShareCurves[keyShare.Group] {
+				return nil, fieldError("KeyShareCurves", i, s, ErrUnfaithful)
+			}
+			extensions.KeyShareCurves.KeyShares = append(extensions.KeyShareCurves.KeyShares, keyShare)
+		}
+	}
+	extensions.NotUsedGREASE = e.NotUsedGREASE
+	if _, err := ToExtraExtensions(e); err != nil {
+		return nil, err
+	}
+	return extensions, nil
+}
+
+// 转换签名算法列表，未知名称按数值解析，如0x0403
+func toSignatureSchemes(field string, names []string, strict bool) ([]utls.SignatureScheme, error) {
+	algorithms := []utls.SignatureScheme{}
+	for i, s := range names {
+		algorithm, ok := supportedSignatureAlgorithmsExtensions[s]
+		if !ok {
+			v, err := strconv.ParseUint(s, 0, 16)
+			if err != nil {
+				return nil, fieldError(field, i, s, ErrUnknownValue)
+			}
+			algorithm = utls.SignatureScheme(v)
+		}
+		if strict && !faithfulSignatureAlgorithms[algorithm] {
+			return nil, fieldError(field, i, s, ErrUnfaithful)
 		}
-		mutex.RUnlock()
+		algorithms = append(algorithms, algorithm)
+	}
+	return algorithms, nil
+}
+
+// 将TLS扩展及额外设置转换回Extensions，与ToTLSExtensions、ToExtraExtensions互为逆操作，无法表示的值返回*FieldError
+func FromTLSExtensions(e *http.TLSExtensions, extra *ExtraExtensions) (*Extensions, error) {
+	extensions := &Extensions{}
+	if extra != nil {
+		extra.toExtensions(extensions)
+	}
+	if e == nil {
+		return extensions, nil
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if e.SupportedSignatureAlgorithms != nil {
+		extensions.SupportedSignatureAlgorithms = fromSignatureSchemes(e.SupportedSignatureAlgorithms.SupportedSignatureAlgorithms)
 	}
-	if e.NotUsedGREASE != false {
-		extensions.NotUsedGREASE = e.NotUsedGREASE
+	if e.CertCompressionAlgo != nil {
+		extensions.CertCompressionAlgo = []string{}
+		for i, algorithm := range e.CertCompressionAlgo.Algorithms {
+			name, ok := nameOf(certCompressionAlgoExtensions, algorithm)
+			if !ok {
+				return nil, fieldError("CertCompressionAlgo", i, algorithm, ErrUnknownValue)
+			}
+			extensions.CertCompressionAlgo = append(extensions.CertCompressionAlgo, name)
+		}
+	}
+	if e.RecordSizeLimit != nil {
+		// 按十六进制书写，0x4001写为4001，含有a-f的数值无法表示
+		limit, err := strconv.Atoi(strconv.FormatUint(uint64(e.RecordSizeLimit.Limit), 16))
+		if err != nil || limit == 0 {
+			return nil, fieldError("RecordSizeLimit", -1, e.RecordSizeLimit.Limit, ErrOutOfRange)
+		}
+		extensions.RecordSizeLimit = limit
+	}
+	if e.DelegatedCredentials != nil {
+		extensions.DelegatedCredentials = fromSignatureSchemes(e.DelegatedCredentials.SupportedSignatureAlgorithms)
+	}
+	if e.SupportedVersions != nil {
+		extensions.SupportedVersions = []string{}
+		for i, version := range e.SupportedVersions.Versions {
+			name, ok := nameOf(supportedVersionsExtensions, version)
+			if !ok {
+				return nil, fieldError("SupportedVersions", i, version, ErrUnknownValue)
+			}
+			extensions.SupportedVersions = append(extensions.SupportedVersions, name)
+		}
+	}
+	if e.PSKKeyExchangeModes != nil {
+		extensions.PSKKeyExchangeModes = []string{}
+		for i, mode := range e.PSKKeyExchangeModes.Modes {
+			name, ok := nameOf(pskKeyExchangeModesExtensions, mode)
+			if !ok {
+				return nil, fieldError("PSKKeyExchangeModes", i, mode, ErrUnknownValue)
+			}
+			extensions.PSKKeyExchangeModes = append(extensions.PSKKeyExchangeModes, name)
+		}
+	}
+	if e.SignatureAlgorithmsCert != nil {
+		extensions.SignatureAlgorithmsCert = fromSignatureSchemes(e.SignatureAlgorithmsCert.SupportedSignatureAlgorithms)
+	}
+	if e.KeyShareCurves != nil {
+		extensions.KeyShareCurves = []string{}
+		for _, keyShare := range e.KeyShareCurves.KeyShares {
+			name := strconv.Itoa(int(keyShare.Group))
+			for n, curve := range keyShareCurvesExtensions {
+				if curve.Group == keyShare.Group {
+					name = n
+					break
+				}
+			}
+			extensions.KeyShareCurves = append(extensions.KeyShareCurves, name)
+		}
+	}
+	extensions.NotUsedGREASE = e.NotUsedGREASE
+	return extensions, nil
+}
+
+// 转换签名算法列表，没有名称的算法写为十六进制数值，如0x0403
+func fromSignatureSchemes(algorithms []utls.SignatureScheme) []string {
+	names := []string{}
+	for _, algorithm := range algorithms {
+		name, ok := nameOf(supportedSignatureAlgorithmsExtensions, algorithm)
+		if !ok {
+			name = fmt.Sprintf("0x%04x", uint16(algorithm))
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// 按值查找名称，多个名称对应同一个值时取字典序最小的，保证结果稳定
+func nameOf[V comparable](names map[string]V, value V) (string, bool) {
+	name, found := "", false
+	for n, v := range names {
+		if v == value && (!found || n < name) {
+			name, found = n, true
+		}
 	}
-	return extensions
+	return name, found
 }
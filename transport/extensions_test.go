@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	utls "github.com/refraction-networking/utls"
+	"reflect"
+	"testing"
+)
+
+// 严格模式拒绝无法解析的扩展编号
+func TestValidateJA3Strict(t *testing.T) {
+	valid := "771,4865-4866,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-17613-65037,29-23-24,0"
+	if err := ValidateJA3Strict(valid); err != nil {
+		t.Fatal(err)
+	}
+	var fieldErr *FieldError
+	err := ValidateJA3Strict("771,4865,0-23-x,29,0")
+	if !errors.Is(err, ErrUnknownValue) || !errors.As(err, &fieldErr) || fieldErr.Field != "JA3.Extensions[2]" {
+		t.Fatalf("err = %v, want ErrUnknownValue for JA3.Extensions[2]", err)
+	}
+	if err = ValidateJA3Strict("771,4865,0-65536,29,0"); !errors.Is(err, ErrUnknownValue) {
+		t.Fatalf("err = %v, want ErrUnknownValue", err)
+	}
+	if err = ValidateJA3Strict("771,4865"); err == nil {
+		t.Fatal("expected an error for a malformed JA3 string")
+	}
+}
+
+// 17513与17613分别以旧编号与新编号的application_settings发送，ExtraExtensions.ALPS对两者都生效
+func TestClientHelloSpecALPS(t *testing.T) {
+	alps := func(spec *utls.ClientHelloSpec) (old, new []string) {
+		for _, extension := range spec.Extensions {
+			switch e := extension.(type) {
+			case *utls.ApplicationSettingsExtension:
+				old = e.SupportedProtocols
+			case *utls.ApplicationSettingsExtensionNew:
+				new = e.SupportedProtocols
+			}
+		}
+		return old, new
+	}
+	spec, err := NewClientHelloSpec("771,4865,0-16-17513-43,29,0", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old, new := alps(spec); !reflect.DeepEqual(old, []string{"h2"}) || new != nil {
+		t.Errorf("17513: old = %v, new = %v", old, new)
+	}
+	spec, err = NewClientHelloSpec("771,4865,0-16-17613-43,29,0", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36", nil, &ExtraExtensions{ALPS: []string{"h3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old, new := alps(spec); old != nil || !reflect.DeepEqual(new, []string{"h3"}) {
+		t.Errorf("17613: old = %v, new = %v", old, new)
+	}
+	spec, err = NewClientHelloSpecFromJA4("t13d0104h2_1301_0000,0010,44cd,002b_0403", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old, new := alps(spec); old != nil || !reflect.DeepEqual(new, []string{"h2"}) {
+		t.Errorf("JA4 44cd: old = %v, new = %v", old, new)
+	}
+}
+
+func FuzzToTLSExtensions(f *testing.F) {
+	f.Add([]byte(`{"SupportedSignatureAlgorithms":["ecdsa_secp256r1_sha256","rsa_pss_rsae_sha256","rsa_pkcs1_sha256"],"CertCompressionAlgo":["brotli"],"SupportedVersions":["GREASE","1.3","1.2"],"PSKKeyExchangeModes":["PskModeDHE"],"KeyShareCurves":["GREASE","4588","X25519"],"RandomExtensionOrder":true}`))
+	f.Add([]byte(`{"RecordSizeLimit":16385,"DelegatedCredentials":["ecdsa_secp256r1_sha256"],"KeyShareCurves":["X25519","P256"],"NotUsedGREASE":true,"ALPN":["h2"],"Padding":"none"}`))
+	f.Add([]byte(`{"KeyShareCurves":["X25519","65072"],"SignatureAlgorithmsCert":["0x0401"],"ECH":{"CipherSuites":[]},"Padding":"12"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e := &Extensions{}
+		if json.Unmarshal(data, e) != nil {
+			return
+		}
+		tlsExtensions, err := ToTLSExtensions(e)
+		if _, strictErr := ToTLSExtensionsStrict(e); strictErr == nil && err != nil {
+			t.Fatalf("strict mode accepted input rejected by ToTLSExtensions: %v", err)
+		}
+		if err != nil {
+			return
+		}
+		extra, err := ToExtraExtensions(e)
+		if err != nil {
+			return
+		}
+		// 转换结果可以还原，再次转换后保持不变
+		restored, err := FromTLSExtensions(tlsExtensions, extra)
+		if err != nil {
+			t.Fatalf("FromTLSExtensions: %v", err)
+		}
+		again, err := ToTLSExtensions(restored)
+		if err != nil {
+			t.Fatalf("restored extensions %+v cannot be converted back: %v", restored, err)
+		}
+		restoredAgain, err := FromTLSExtensions(again, extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := json.Marshal(restored)
+		b, _ := json.Marshal(restoredAgain)
+		if string(a) != string(b) {
+			t.Fatalf("round trip changed extensions: %s != %s", a, b)
+		}
+	})
+}
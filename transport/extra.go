@@ -0,0 +1,206 @@
+package transport
+
+import (
+	utls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+	"strconv"
+	"strings"
+)
+
+// http.TLSExtensions之外的ClientHello设置，设置在Session或请求的ExtraExtensions中，与TLSExtensions一同生效，
+// 只包含普通值，复制或序列化后设置不变
+type ExtraExtensions struct {
+	ALPN                 []string   `json:"ALPN,omitempty"`                 // application_layer_protocol_negotiation(16)的协议列表
+	ALPS                 []string   `json:"ALPS,omitempty"`                 // application_settings(17513或17613)的协议列表
+	ECH                  *ECHGrease `json:"ECH,omitempty"`                  // encrypted_client_hello(65037)的GREASE参数
+	Padding              string     `json:"Padding,omitempty"`              // padding(21)：boring、none或固定长度
+	PreSharedKey         bool       `json:"PreSharedKey,omitempty"`         // 在末尾添加pre_shared_key(41)，并开启会话恢复
+	RandomExtensionOrder bool       `json:"RandomExtensionOrder,omitempty"` // 每次握手按Chrome的规则随机排列扩展
+	StatusRequestV2      bool       `json:"StatusRequestV2,omitempty"`      // 将status_request_v2(17)生成为带OCSP请求的完整扩展
+}
+
+// ECH GREASE参数
+type ECHGrease struct {
+	// HPKE密码套件，格式为"KDF/AEAD"，如"HKDF_SHA256/AES_128_GCM"
+	//KDF: HKDF_SHA256, HKDF_SHA384, HKDF_SHA512
+	//AEAD: AES_128_GCM, AES_256_GCM, CHACHA20_POLY1305
+	CipherSuites   []string `json:"CipherSuites"`
+	ConfigIDs      []int    `json:"ConfigIDs"`      // 为空时随机生成
+	PayloadLengths []int    `json:"PayloadLengths"` // 加密前的载荷长度，如[128, 160, 192, 224]
+}
+
+var echKDFs = map[string]utls.HPKE_KDF_ID{
+	"HKDF_SHA256": dicttls.HKDF_SHA256,
+	"HKDF_SHA384": dicttls.HKDF_SHA384,
+	"HKDF_SHA512": dicttls.HKDF_SHA512,
+}
+
+var echAEADs = map[string]utls.HPKE_AEAD_ID{
+	"AES_128_GCM":       dicttls.AEAD_AES_128_GCM,
+	"AES_256_GCM":       dicttls.AEAD_AES_256_GCM,
+	"CHACHA20_POLY1305": dicttls.AEAD_CHACHA20_POLY1305,
+}
+
+// 转换Extensions中的额外设置，没有设置时返回nil，值无效时返回*FieldError
+func ToExtraExtensions(e *Extensions) (*ExtraExtensions, error) {
+	if e == nil || (e.ALPN == nil && e.ALPS == nil && e.ECH == nil && e.Padding == "" && !e.PreSharedKey && !e.RandomExtensionOrder && !e.StatusRequestV2) {
+		return nil, nil
+	}
+	extra := &ExtraExtensions{
+		ALPN:                 append([]string(nil), e.ALPN...),
+		ALPS:                 append([]string(nil), e.ALPS...),
+		Padding:              e.Padding,
+		PreSharedKey:         e.PreSharedKey,
+		RandomExtensionOrder: e.RandomExtensionOrder,
+		StatusRequestV2:      e.StatusRequestV2,
+	}
+	// 保留显式设置的空列表
+	if e.ALPN != nil && extra.ALPN == nil {
+		extra.ALPN = []string{}
+	}
+	if e.ALPS != nil && extra.ALPS == nil {
+		extra.ALPS = []string{}
+	}
+	if e.ECH != nil {
+		extra.ECH = &ECHGrease{
+			CipherSuites:   append([]string(nil), e.ECH.CipherSuites...),
+			ConfigIDs:      append([]int(nil), e.ECH.ConfigIDs...),
+			PayloadLengths: append([]int(nil), e.ECH.PayloadLengths...),
+		}
+	}
+	if err := extra.validate(); err != nil {
+		return nil, err
+	}
+	return extra, nil
+}
+
+// 将额外设置写回Extensions
+func (extra *ExtraExtensions) toExtensions(e *Extensions) {
+	e.ALPN = extra.ALPN
+	e.ALPS = extra.ALPS
+	e.ECH = extra.ECH
+	e.Padding = extra.Padding
+	e.PreSharedKey = extra.PreSharedKey
+	e.RandomExtensionOrder = extra.RandomExtensionOrder
+	e.StatusRequestV2 = extra.StatusRequestV2
+}
+
+// 校验ECH与Padding的取值
+func (extra *ExtraExtensions) validate() error {
+	if _, err := extra.echExtension(); err != nil {
+		return err
+	}
+	_, err := extra.paddingExtension()
+	return err
+}
+
+// 生成ECH GREASE扩展，未设置时返回nil
+func (extra *ExtraExtensions) echExtension() (*utls.GREASEEncryptedClientHelloExtension, error) {
+	if extra.ECH == nil {
+		return nil, nil
+	}
+	ech := &utls.GREASEEncryptedClientHelloExtension{}
+	for i, s := range extra.ECH.CipherSuites {
+		kdf, aead, _ := strings.Cut(s, "/")
+		kdfID, ok1 := echKDFs[kdf]
+		aeadID, ok2 := echAEADs[aead]
+		if !ok1 || !ok2 {
+			return nil, fieldError("ECH.CipherSuites", i, s, ErrUnknownValue)
+		}
+		ech.CandidateCipherSuites = append(ech.CandidateCipherSuites, utls.HPKESymmetricCipherSuite{KdfId: kdfID, AeadId: aeadID})
+	}
+	for i, id := range extra.ECH.ConfigIDs {
+		if id < 0 || id > 255 {
+			return nil, fieldError("ECH.ConfigIDs", i, id, ErrOutOfRange)
+		}
+		ech.CandidateConfigIds = append(ech.CandidateConfigIds, uint8(id))
+	}
+	for i, length := range extra.ECH.PayloadLengths {
+		if length <= 0 || length > 0xffff-16 {
+			return nil, fieldError("ECH.PayloadLengths", i, length, ErrOutOfRange)
+		}
+		ech.CandidatePayloadLens = append(ech.CandidatePayloadLens, uint16(length))
+	}
+	return ech, nil
+}
+
+// 生成padding扩展，未设置时返回nil，WillPad为false表示移除该扩展
+func (extra *ExtraExtensions) paddingExtension() (*utls.UtlsPaddingExtension, error) {
+	switch extra.Padding {
+	case "":
+		return nil, nil
+	case "boring":
+		return &utls.UtlsPaddingExtension{WillPad: true, GetPaddingLen: utls.BoringPaddingStyle}, nil
+	case "none":
+		return &utls.UtlsPaddingExtension{WillPad: false}, nil
+	}
+	length, err := strconv.ParseUint(extra.Padding, 10, 16)
+	if err != nil {
+		return nil, fieldError("Padding", -1, extra.Padding, ErrUnknownValue)
+	}
+	return &utls.UtlsPaddingExtension{WillPad: true, GetPaddingLen: func(int) (int, bool) {
+		return int(length), true
+	}}, nil
+}
+
+// 将额外设置应用到ClientHelloSpec，extra为nil时不做修改
+func (extra *ExtraExtensions) apply(spec *utls.ClientHelloSpec) error {
+	if extra == nil {
+		return nil
+	}
+	ech, err := extra.echExtension()
+	if err != nil {
+		return err
+	}
+	padding, err := extra.paddingExtension()
+	if err != nil {
+		return err
+	}
+	extensions := spec.Extensions[:0:0]
+	for _, extension := range spec.Extensions {
+		switch ext := extension.(type) {
+		case *utls.GenericExtension:
+			// chttp将17生成为空的GenericExtension，开启后替换为带OCSP请求的status_request_v2
+			if extra.StatusRequestV2 && ext.Id == 17 && len(ext.Data) == 0 {
+				extension = &utls.StatusRequestV2Extension{}
+			}
+		case *utls.ALPNExtension:
+			if extra.ALPN != nil {
+				ext.AlpnProtocols = append([]string(nil), extra.ALPN...)
+			}
+		case *utls.ApplicationSettingsExtension:
+			if extra.ALPS != nil {
+				ext.SupportedProtocols = append([]string(nil), extra.ALPS...)
+			}
+		case *utls.ApplicationSettingsExtensionNew:
+			if extra.ALPS != nil {
+				ext.SupportedProtocols = append([]string(nil), extra.ALPS...)
+			}
+		case *utls.GREASEEncryptedClientHelloExtension:
+			if ech != nil {
+				extension = ech
+			}
+		case *utls.UtlsPaddingExtension:
+			if padding != nil {
+				if !padding.WillPad {
+					continue
+				}
+				extension = padding
+			}
+		case *utls.UtlsPreSharedKeyExtension:
+			if extra.PreSharedKey {
+				continue
+			}
+		}
+		extensions = append(extensions, extension)
+	}
+	// pre_shared_key必须是最后一个扩展
+	if extra.PreSharedKey {
+		extensions = append(extensions, &utls.UtlsPreSharedKeyExtension{})
+	}
+	if extra.RandomExtensionOrder {
+		extensions = utls.ShuffleChromeTLSExtensions(extensions)
+	}
+	spec.Extensions = extensions
+	return nil
+}
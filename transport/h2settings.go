@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"fmt"
 	http "github.com/wangluozhe/chttp"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -34,134 +36,249 @@ type H2Settings struct {
 	ConnectionFlow int                      `json:"ConnectionFlow"`
 	HeaderPriority map[string]interface{}   `json:"HeaderPriority"`
 	PriorityFrames []map[string]interface{} `json:"PriorityFrames"`
+	// 伪头部顺序，如[":method", ":authority", ":scheme", ":path"]，需设置到请求头的http.PHeaderOrderKey中
+	PseudoHeaderOrder []string `json:"PseudoHeaderOrder"`
 }
 
 func covertSettingNameToID(name string) http.HTTP2SettingID {
+	id, _ := settingNameToID(name)
+	return id
+}
+
+// 设置名称转换为ID，支持UNKNOWN_SETTING_前缀及纯数字
+func settingNameToID(name string) (http.HTTP2SettingID, bool) {
 	if id, ok := settings[name]; ok {
-		return id
+		return id, true
 	}
-	if strings.Index(name, "UNKNOWN_SETTING_") != -1 {
-		name = strings.Replace(name, "UNKNOWN_SETTING_", "", -1)
+	id, err := strconv.ParseUint(strings.TrimPrefix(name, "UNKNOWN_SETTING_"), 10, 16)
+	if err != nil || id == 0 {
+		return 0, false
 	}
-	id, _ := strconv.Atoi(name)
-	return http.HTTP2SettingID(id)
+	return http.HTTP2SettingID(id), true
+}
+
+// 转换HTTP2设置，字段类型或数值无效时返回*FieldError。
+// 按SettingsOrder转换时跳过值为0的设置（ENABLE_PUSH除外），未设置SettingsOrder时保留所有设置
+func ToHTTP2Settings(h2Settings *H2Settings) (*http.HTTP2Settings, error) {
+	return toHTTP2Settings(h2Settings, false)
 }
 
-func ToHTTP2Settings(h2Settings *H2Settings) (http2Settings *http.HTTP2Settings) {
-	http2Settings = &http.HTTP2Settings{
-		Settings:       nil,
-		ConnectionFlow: 0,
+// 严格模式转换HTTP2设置，额外拒绝RFC 9113未定义的设置、超出协议范围的设置值、
+// SettingsOrder中重复或不存在的设置以及依赖自身的PRIORITY帧
+func ToHTTP2SettingsStrict(h2Settings *H2Settings) (*http.HTTP2Settings, error) {
+	return toHTTP2Settings(h2Settings, true)
+}
+
+func toHTTP2Settings(h2Settings *H2Settings, strict bool) (*http.HTTP2Settings, error) {
+	http2Settings := &http.HTTP2Settings{
 		HeaderPriority: &http.HTTP2PriorityParam{},
-		PriorityFrames: nil,
 	}
+	if h2Settings == nil {
+		return http2Settings, nil
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
 	if h2Settings.Settings != nil {
-		if h2Settings.SettingsOrder != nil {
-			for _, orderKey := range h2Settings.SettingsOrder {
-				val := h2Settings.Settings[orderKey]
-				if val != 0 || orderKey == "ENABLE_PUSH" {
-					http2Settings.Settings = append(http2Settings.Settings, http.HTTP2Setting{
-						ID:  covertSettingNameToID(orderKey),
-						Val: uint32(val),
-					})
+		order := h2Settings.SettingsOrder
+		if order == nil {
+			for name := range h2Settings.Settings {
+				order = append(order, name)
+			}
+		}
+		seen := make(map[http.HTTP2SettingID]bool)
+		for i, name := range order {
+			field := "SettingsOrder"
+			if h2Settings.SettingsOrder == nil {
+				field, i = "Settings", -1
+			}
+			id, ok := settingNameToID(name)
+			if !ok {
+				return nil, fieldError(field, i, name, ErrUnknownValue)
+			}
+			val, ok := h2Settings.Settings[name]
+			if !ok {
+				if strict {
+					return nil, fieldError(field, i, name, ErrMissingField)
 				}
+				continue
+			}
+			// SettingsOrder中值为0的设置不发送，ENABLE_PUSH为0表示禁用推送，需要发送
+			if val == 0 && h2Settings.SettingsOrder != nil && id != http.HTTP2SettingEnablePush {
+				continue
 			}
-		} else {
-			mutex.RLock()
-			for id, val := range h2Settings.Settings {
-				http2Settings.Settings = append(http2Settings.Settings, http.HTTP2Setting{
-					ID:  covertSettingNameToID(id),
-					Val: uint32(val),
-				})
+			if val < 0 || uint64(val) > math.MaxUint32 {
+				return nil, fieldError("Settings."+name, -1, val, ErrOutOfRange)
+			}
+			if strict {
+				if seen[id] {
+					return nil, fieldError(field, i, name, ErrUnfaithful)
+				}
+				if err := checkSetting(id, uint32(val)); err != nil {
+					return nil, fieldError("Settings."+name, -1, val, err)
+				}
 			}
-			mutex.RUnlock()
+			seen[id] = true
+			http2Settings.Settings = append(http2Settings.Settings, http.HTTP2Setting{ID: id, Val: uint32(val)})
 		}
 	}
-	if h2Settings.ConnectionFlow != 0 {
-		http2Settings.ConnectionFlow = h2Settings.ConnectionFlow
+	if h2Settings.ConnectionFlow < 0 || h2Settings.ConnectionFlow > math.MaxInt32 {
+		return nil, fieldError("ConnectionFlow", -1, h2Settings.ConnectionFlow, ErrOutOfRange)
 	}
+	http2Settings.ConnectionFlow = h2Settings.ConnectionFlow
 	if h2Settings.HeaderPriority != nil {
-		mutex.RLock()
-		var weight int
-		var streamDep int
-		w := h2Settings.HeaderPriority["weight"]
-		switch w.(type) {
-		case int:
-			weight = w.(int)
-		case float64:
-			weight = int(w.(float64))
+		priorityParam, err := toPriorityParam("HeaderPriority", h2Settings.HeaderPriority)
+		if err != nil {
+			return nil, err
 		}
-		s := h2Settings.HeaderPriority["streamDep"]
-		switch s.(type) {
-		case int:
-			streamDep = s.(int)
-		case float64:
-			streamDep = int(s.(float64))
+		http2Settings.HeaderPriority = priorityParam
+	}
+	for i, frame := range h2Settings.PriorityFrames {
+		field := fmt.Sprintf("PriorityFrames[%d]", i)
+		streamID, err := toUint31(field+".streamID", frame["streamID"])
+		if err != nil {
+			return nil, err
 		}
-		var priorityParam *http.HTTP2PriorityParam
-		if w == nil {
-			priorityParam = &http.HTTP2PriorityParam{
-				StreamDep: uint32(streamDep),
-				Exclusive: h2Settings.HeaderPriority["exclusive"].(bool),
-			}
-		} else {
-			priorityParam = &http.HTTP2PriorityParam{
-				StreamDep: uint32(streamDep),
-				Exclusive: h2Settings.HeaderPriority["exclusive"].(bool),
-				Weight:    uint8(weight - 1),
-			}
+		if streamID == 0 {
+			return nil, fieldError(field+".streamID", -1, streamID, ErrOutOfRange)
 		}
-		http2Settings.HeaderPriority = priorityParam
-		mutex.RUnlock()
-	}
-	if h2Settings.PriorityFrames != nil {
-		for _, frame := range h2Settings.PriorityFrames {
-			mutex.RLock()
-			var weight int
-			var streamDep int
-			var streamID int
-			priorityParamSource := frame["priorityParam"].(map[string]interface{})
-			w := priorityParamSource["weight"]
-			switch w.(type) {
-			case int:
-				weight = w.(int)
-			case float64:
-				weight = int(w.(float64))
-			}
-			s := priorityParamSource["streamDep"]
-			switch s.(type) {
-			case int:
-				streamDep = s.(int)
-			case float64:
-				streamDep = int(s.(float64))
+		source, ok := frame["priorityParam"].(map[string]interface{})
+		if !ok {
+			if frame["priorityParam"] == nil {
+				return nil, fieldError(field+".priorityParam", -1, nil, ErrMissingField)
 			}
-			sid := frame["streamID"]
-			switch sid.(type) {
-			case int:
-				streamID = sid.(int)
-			case float64:
-				streamID = int(sid.(float64))
-			}
-			var priorityParam http.HTTP2PriorityParam
-			if w == nil {
-				priorityParam = http.HTTP2PriorityParam{
-					StreamDep: uint32(streamDep),
-					Exclusive: priorityParamSource["exclusive"].(bool),
-				}
-			} else {
-				priorityParam = http.HTTP2PriorityParam{
-					StreamDep: uint32(streamDep),
-					Exclusive: priorityParamSource["exclusive"].(bool),
-					Weight:    uint8(weight - 1),
-				}
-			}
-			http2Settings.PriorityFrames = append(http2Settings.PriorityFrames, http.HTTP2PriorityFrame{
-				HTTP2FrameHeader: http.HTTP2FrameHeader{
-					StreamID: uint32(streamID),
-				},
-				HTTP2PriorityParam: priorityParam,
-			})
-			mutex.RUnlock()
+			return nil, fieldError(field+".priorityParam", -1, frame["priorityParam"], ErrInvalidType)
+		}
+		priorityParam, err := toPriorityParam(field+".priorityParam", source)
+		if err != nil {
+			return nil, err
+		}
+		if strict && priorityParam.StreamDep == streamID {
+			return nil, fieldError(field+".priorityParam.streamDep", -1, priorityParam.StreamDep, ErrUnfaithful)
 		}
+		http2Settings.PriorityFrames = append(http2Settings.PriorityFrames, http.HTTP2PriorityFrame{
+			HTTP2FrameHeader: http.HTTP2FrameHeader{
+				StreamID: streamID,
+			},
+			HTTP2PriorityParam: *priorityParam,
+		})
+	}
+	return http2Settings, nil
+}
+
+// 校验设置值是否符合RFC 9113
+func checkSetting(id http.HTTP2SettingID, val uint32) error {
+	switch id {
+	case http.HTTP2SettingHeaderTableSize, http.HTTP2SettingMaxConcurrentStreams, http.HTTP2SettingMaxHeaderListSize:
+	case http.HTTP2SettingEnablePush, 0x8, 0x9:
+		if val > 1 {
+			return ErrUnfaithful
+		}
+	case http.HTTP2SettingInitialWindowSize:
+		if val > math.MaxInt32 {
+			return ErrUnfaithful
+		}
+	case http.HTTP2SettingMaxFrameSize:
+		if val < 1<<14 || val > 1<<24-1 {
+			return ErrUnfaithful
+		}
+	default:
+		return ErrUnfaithful
+	}
+	return nil
+}
+
+// 转换优先级参数，weight取值1-256
+func toPriorityParam(field string, source map[string]interface{}) (*http.HTTP2PriorityParam, error) {
+	streamDep, err := toUint31(field+".streamDep", source["streamDep"])
+	if err != nil {
+		return nil, err
+	}
+	priorityParam := &http.HTTP2PriorityParam{StreamDep: streamDep}
+	switch exclusive := source["exclusive"].(type) {
+	case bool:
+		priorityParam.Exclusive = exclusive
+	case nil:
+		return nil, fieldError(field+".exclusive", -1, nil, ErrMissingField)
+	default:
+		return nil, fieldError(field+".exclusive", -1, exclusive, ErrInvalidType)
+	}
+	if source["weight"] != nil {
+		weight, err := toNumber(field+".weight", source["weight"])
+		if err != nil {
+			return nil, err
+		}
+		if weight < 1 || weight > 256 {
+			return nil, fieldError(field+".weight", -1, source["weight"], ErrOutOfRange)
+		}
+		priorityParam.Weight = uint8(weight - 1)
+	}
+	return priorityParam, nil
+}
+
+// 转换流ID，取值0到2^31-1，未设置时为0
+func toUint31(field string, v interface{}) (uint32, error) {
+	if v == nil {
+		return 0, nil
+	}
+	n, err := toNumber(field, v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > math.MaxInt32 {
+		return 0, fieldError(field, -1, v, ErrOutOfRange)
+	}
+	return uint32(n), nil
+}
+
+// JSON解析得到的数值为float64，必须为整数
+func toNumber(field string, v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return 0, fieldError(field, -1, v, ErrInvalidType)
+		}
+		return int64(n), nil
+	}
+	return 0, fieldError(field, -1, v, ErrInvalidType)
+}
+
+// 将HTTP2设置转换回H2Settings，与ToHTTP2Settings互为逆操作，伪头部顺序保存在请求头中，不在转换结果内
+func FromHTTP2Settings(http2Settings *http.HTTP2Settings) *H2Settings {
+	h2Settings := &H2Settings{}
+	if http2Settings == nil {
+		return h2Settings
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if http2Settings.Settings != nil {
+		h2Settings.Settings = map[string]int{}
+		h2Settings.SettingsOrder = []string{}
+		for _, setting := range http2Settings.Settings {
+			name := settingName(uint16(setting.ID))
+			h2Settings.Settings[name] = int(setting.Val)
+			h2Settings.SettingsOrder = append(h2Settings.SettingsOrder, name)
+		}
+	}
+	h2Settings.ConnectionFlow = http2Settings.ConnectionFlow
+	if http2Settings.HeaderPriority != nil {
+		h2Settings.HeaderPriority = fromPriorityParam(http2Settings.HeaderPriority)
+	}
+	for _, frame := range http2Settings.PriorityFrames {
+		h2Settings.PriorityFrames = append(h2Settings.PriorityFrames, map[string]interface{}{
+			"streamID":      int(frame.StreamID),
+			"priorityParam": fromPriorityParam(&frame.HTTP2PriorityParam),
+		})
+	}
+	return h2Settings
+}
+
+// 转换优先级参数，Weight按协议中的1到256书写
+func fromPriorityParam(priorityParam *http.HTTP2PriorityParam) map[string]interface{} {
+	return map[string]interface{}{
+		"weight":    int(priorityParam.Weight) + 1,
+		"streamDep": int(priorityParam.StreamDep),
+		"exclusive": priorityParam.Exclusive,
 	}
-	return http2Settings
 }
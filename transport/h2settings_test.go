@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"encoding/json"
+	http "github.com/wangluozhe/chttp"
+	"reflect"
+	"testing"
+)
+
+// SettingsOrder中值为0的设置不发送，ENABLE_PUSH除外；未设置SettingsOrder时保留所有设置
+func TestToHTTP2SettingsZeroValues(t *testing.T) {
+	h2Settings := &H2Settings{
+		Settings:      map[string]int{"HEADER_TABLE_SIZE": 65536, "ENABLE_PUSH": 0, "MAX_CONCURRENT_STREAMS": 0},
+		SettingsOrder: []string{"HEADER_TABLE_SIZE", "ENABLE_PUSH", "MAX_CONCURRENT_STREAMS"},
+	}
+	for _, convert := range []func(*H2Settings) (*http.HTTP2Settings, error){ToHTTP2Settings, ToHTTP2SettingsStrict} {
+		http2Settings, err := convert(h2Settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []http.HTTP2Setting{{ID: http.HTTP2SettingHeaderTableSize, Val: 65536}, {ID: http.HTTP2SettingEnablePush}}
+		if !reflect.DeepEqual(http2Settings.Settings, want) {
+			t.Fatalf("Settings = %v, want %v", http2Settings.Settings, want)
+		}
+	}
+	http2Settings, err := ToHTTP2Settings(&H2Settings{Settings: map[string]int{"MAX_CONCURRENT_STREAMS": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []http.HTTP2Setting{{ID: http.HTTP2SettingMaxConcurrentStreams}}; !reflect.DeepEqual(http2Settings.Settings, want) {
+		t.Fatalf("Settings = %v, want %v", http2Settings.Settings, want)
+	}
+}
+
+func FuzzToHTTP2Settings(f *testing.F) {
+	f.Add([]byte(`{"Settings":{"HEADER_TABLE_SIZE":65536,"ENABLE_PUSH":0,"INITIAL_WINDOW_SIZE":6291456,"MAX_HEADER_LIST_SIZE":262144},"SettingsOrder":["HEADER_TABLE_SIZE","ENABLE_PUSH","INITIAL_WINDOW_SIZE","MAX_HEADER_LIST_SIZE"],"ConnectionFlow":15663105,"HeaderPriority":{"weight":256,"streamDep":0,"exclusive":true}}`))
+	f.Add([]byte(`{"Settings":{"HEADER_TABLE_SIZE":65536,"INITIAL_WINDOW_SIZE":131072,"MAX_FRAME_SIZE":16384},"ConnectionFlow":12517377,"PriorityFrames":[{"streamID":3,"priorityParam":{"weight":201,"streamDep":0,"exclusive":false}}]}`))
+	f.Add([]byte(`{"Settings":{"UNKNOWN_SETTING_8":1,"9":1},"SettingsOrder":["9","UNKNOWN_SETTING_8","9"]}`))
+	f.Add([]byte(`{"HeaderPriority":{"weight":0.5,"exclusive":"yes"}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h2Settings := &H2Settings{}
+		if json.Unmarshal(data, h2Settings) != nil {
+			return
+		}
+		http2Settings, err := ToHTTP2Settings(h2Settings)
+		if _, strictErr := ToHTTP2SettingsStrict(h2Settings); strictErr == nil && err != nil {
+			t.Fatalf("strict mode accepted input rejected by ToHTTP2Settings: %v", err)
+		}
+		if err != nil {
+			return
+		}
+		// 转换结果可以还原，再次转换后保持不变
+		once, err := ToHTTP2Settings(FromHTTP2Settings(http2Settings))
+		if err != nil {
+			t.Fatalf("FromHTTP2Settings(%+v) cannot be converted back: %v", http2Settings, err)
+		}
+		twice, err := ToHTTP2Settings(FromHTTP2Settings(once))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(once, twice) {
+			t.Fatalf("round trip changed settings: %+v != %+v", once, twice)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"fmt"
+	utls "github.com/refraction-networking/utls"
+	http "github.com/wangluozhe/chttp"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JA4中无法还原的椭圆曲线与点格式使用的默认值
+const (
+	ja4DefaultCurves       = "29-23-24"
+	ja4DefaultPointFormats = "0"
+)
+
+var hashedJA4Section = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// 由JA4_r或JA4_ro还原出的ClientHello参数
+type JA4Spec struct {
+	JA3                 string // 等价的JA3字符串，椭圆曲线与点格式使用默认值
+	SignatureAlgorithms []utls.SignatureScheme
+	SupportedVersions   []uint16
+	ALPN                []string // 为nil时不发送ALPN扩展
+}
+
+// 解析JA4_r（密码套件与扩展已排序）或JA4_ro（保持发送顺序）字符串，
+// 哈希形式的JA4无法还原密码套件与扩展，返回错误
+func ParseJA4(ja4 string) (*JA4Spec, error) {
+	parts := strings.Split(ja4, "_")
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, fmt.Errorf("invalid JA4 string %q: expected 3 or 4 underscore separated sections", ja4)
+	}
+	prefix := parts[0]
+	if len(prefix) != 10 {
+		return nil, fmt.Errorf("invalid JA4 string %q: malformed prefix %q", ja4, prefix)
+	}
+	if hashedJA4Section.MatchString(parts[1]) || len(parts) == 3 && hashedJA4Section.MatchString(parts[2]) {
+		return nil, fmt.Errorf("JA4 string %q is hashed and cannot be reversed, use the JA4_r or JA4_ro form", ja4)
+	}
+	if prefix[0] != 't' {
+		return nil, fmt.Errorf("invalid JA4 string %q: only TCP (t) fingerprints are supported", ja4)
+	}
+
+	spec := &JA4Spec{}
+	var version uint16
+	switch prefix[1:3] {
+	case "13":
+		version = utls.VersionTLS12
+		spec.SupportedVersions = []uint16{utls.VersionTLS13, utls.VersionTLS12}
+	case "12":
+		version = utls.VersionTLS12
+		spec.SupportedVersions = []uint16{utls.VersionTLS12}
+	case "11":
+		version = utls.VersionTLS11
+	case "10":
+		version = utls.VersionTLS10
+	default:
+		return nil, fmt.Errorf("invalid JA4 string %q: unsupported TLS version %q", ja4, prefix[1:3])
+	}
+	sni := prefix[3]
+	if sni != 'd' && sni != 'i' {
+		return nil, fmt.Errorf("invalid JA4 string %q: SNI flag must be d or i", ja4)
+	}
+	cipherCount, err1 := strconv.Atoi(prefix[4:6])
+	extensionCount, err2 := strconv.Atoi(prefix[6:8])
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid JA4 string %q: malformed cipher or extension count", ja4)
+	}
+	switch prefix[8:10] {
+	case "00":
+	case "h2":
+		spec.ALPN = []string{"h2", "http/1.1"}
+	case "h1":
+		spec.ALPN = []string{"http/1.1"}
+	default:
+		return nil, fmt.Errorf("invalid JA4 string %q: unsupported ALPN %q", ja4, prefix[8:10])
+	}
+
+	ciphers, err := parseHexList(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA4 string %q: cipher suites: %w", ja4, err)
+	}
+	if cipherCount != 99 && len(ciphers) != cipherCount {
+		return nil, fmt.Errorf("invalid JA4 string %q: prefix declares %d cipher suites, got %d", ja4, cipherCount, len(ciphers))
+	}
+	extensions, err := parseHexList(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA4 string %q: extensions: %w", ja4, err)
+	}
+	// JA4_r不包含SNI与ALPN扩展，按前缀补回
+	if sni == 'd' && !containsUint16(extensions, 0) {
+		extensions = append([]uint16{0}, extensions...)
+	}
+	if spec.ALPN != nil && !containsUint16(extensions, 16) {
+		i := 0
+		if len(extensions) > 0 && extensions[0] == 0 {
+			i = 1
+		}
+		extensions = append(extensions[:i:i], append([]uint16{16}, extensions[i:]...)...)
+	}
+	if extensionCount != 99 && len(extensions) != extensionCount {
+		return nil, fmt.Errorf("invalid JA4 string %q: prefix declares %d extensions, got %d", ja4, extensionCount, len(extensions))
+	}
+	if len(parts) == 4 {
+		algorithms, err := parseHexList(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid JA4 string %q: signature algorithms: %w", ja4, err)
+		}
+		for _, algorithm := range algorithms {
+			spec.SignatureAlgorithms = append(spec.SignatureAlgorithms, utls.SignatureScheme(algorithm))
+		}
+	}
+
+	var curves, pointFormats string
+	if containsUint16(extensions, 10) {
+		curves = ja4DefaultCurves
+	}
+	if containsUint16(extensions, 11) {
+		pointFormats = ja4DefaultPointFormats
+	}
+	spec.JA3 = strings.Join([]string{strconv.Itoa(int(version)), joinUint16(ciphers), joinUint16(extensions), curves, pointFormats}, ",")
+	return spec, nil
+}
+
+// 根据JA4_r或JA4_ro字符串生成ClientHelloSpec，JA4中的签名算法与ALPN优先于tlsExtensions，
+// 但extra中显式设置的ALPN列表优先于JA4
+func NewClientHelloSpecFromJA4(ja4, userAgent string, tlsExtensions *http.TLSExtensions, extra *ExtraExtensions) (*utls.ClientHelloSpec, error) {
+	ja4Spec, err := ParseJA4(ja4)
+	if err != nil {
+		return nil, err
+	}
+	extensions := CloneTLSExtensions(tlsExtensions)
+	if ja4Spec.SignatureAlgorithms != nil {
+		extensions.SupportedSignatureAlgorithms = &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: ja4Spec.SignatureAlgorithms}
+	}
+	if extensions.SupportedVersions == nil && ja4Spec.SupportedVersions != nil {
+		extensions.SupportedVersions = &utls.SupportedVersionsExtension{Versions: ja4Spec.SupportedVersions}
+	}
+	spec, err := extensions.StringToSpec(ja4Spec.JA3, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	useNewALPS(spec, ja4Spec.JA3)
+	for _, extension := range spec.Extensions {
+		if alpn, ok := extension.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = ja4Spec.ALPN
+		}
+	}
+	if err = extra.apply(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// 解析以逗号分隔的四位十六进制列表
+func parseHexList(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var list []uint16
+	for _, field := range strings.Split(s, ",") {
+		if len(field) != 4 {
+			return nil, fmt.Errorf("%q is not a 4 digit hex value", field)
+		}
+		v, err := strconv.ParseUint(field, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a 4 digit hex value", field)
+		}
+		list = append(list, uint16(v))
+	}
+	return list, nil
+}
+
+func joinUint16(values []uint16) string {
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(list, "-")
+}
+
+func containsUint16(values []uint16, v uint16) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
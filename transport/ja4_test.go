@@ -0,0 +1,151 @@
+package transport
+
+import (
+	utls "github.com/refraction-networking/utls"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// JA4规范README中Chrome的JA4_r示例
+const chromeJA4r = "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_0403,0804,0401,0503,0805,0501,0806,0601"
+
+func TestParseJA4(t *testing.T) {
+	tests := []struct {
+		name     string
+		ja4      string
+		ja3      string
+		versions []uint16
+		alpn     []string
+		sigAlgs  []utls.SignatureScheme
+	}{
+		{
+			// 排序后的JA4_r，SNI与ALPN扩展按前缀补在最前面
+			name:     "JA4_r",
+			ja4:      chromeJA4r,
+			ja3:      "771,47-53-156-157-4865-4866-4867-49171-49172-49195-49196-49199-49200-52392-52393,0-16-5-10-11-13-18-21-23-27-35-43-45-51-17513-65281,29-23-24,0",
+			versions: []uint16{utls.VersionTLS13, utls.VersionTLS12},
+			alpn:     []string{"h2", "http/1.1"},
+			sigAlgs:  []utls.SignatureScheme{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+		},
+		{
+			// JA4_ro保持发送顺序，没有签名算法部分
+			name:     "JA4_ro",
+			ja4:      "t13d0405h2_1301,c02b,1302,c02f_0000,002b,0010,000b,000a",
+			ja3:      "771,4865-49195-4866-49199,0-43-16-11-10,29-23-24,0",
+			versions: []uint16{utls.VersionTLS13, utls.VersionTLS12},
+			alpn:     []string{"h2", "http/1.1"},
+		},
+		{
+			name:     "TLS 1.2 without SNI and ALPN",
+			ja4:      "t12i020100_c02f,c02b_000d_0401",
+			ja3:      "771,49199-49195,13,,",
+			versions: []uint16{utls.VersionTLS12},
+			sigAlgs:  []utls.SignatureScheme{0x0401},
+		},
+		{
+			name: "counts of 99",
+			ja4:  "t10d9999h1_002f_000b",
+			ja3:  "769,47,0-16-11,,0",
+			alpn: []string{"http/1.1"},
+		},
+	}
+	for _, test := range tests {
+		spec, err := ParseJA4(test.ja4)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if spec.JA3 != test.ja3 {
+			t.Errorf("%s: JA3 = %s, want %s", test.name, spec.JA3, test.ja3)
+		}
+		if !reflect.DeepEqual(spec.SupportedVersions, test.versions) || !reflect.DeepEqual(spec.ALPN, test.alpn) || !reflect.DeepEqual(spec.SignatureAlgorithms, test.sigAlgs) {
+			t.Errorf("%s: spec = %+v", test.name, spec)
+		}
+	}
+}
+
+func TestParseJA4Errors(t *testing.T) {
+	tests := map[string]string{
+		"t13d1516h2_002f":                      "sections",
+		"t13d0101h2_002f_000a_0403_0401":       "sections",
+		"t13d1516h2_8daaf6152771_b186095e22b6": "hashed",
+		"t13d0101h2_002g_000a":                 "hex",
+		"t13d0101h2_02f_000a":                  "hex",
+		"t13d0103h2_002f_000a_04x3":            "hex",
+		"t13d0201h2_002f_000a":                 "declares 2 cipher suites",
+		"t13d0104h2_002f_000a":                 "declares 4 extensions",
+		"q13d0101h2_002f_000a":                 "TCP",
+		"t14d0101h2_002f_000a":                 "version",
+		"t13x0101h2_002f_000a":                 "SNI",
+		"t13d0a01h2_002f_000a":                 "count",
+		"t13d0101h3_002f_000a":                 "ALPN",
+		"t13d01h2_002f_000a":                   "prefix",
+	}
+	for ja4, want := range tests {
+		_, err := ParseJA4(ja4)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseJA4(%q) = %v, want an error containing %q", ja4, err, want)
+		}
+	}
+}
+
+// 去掉chttp按Chrome的方式加入的GREASE密码套件与扩展
+func withoutGREASE(spec *utls.ClientHelloSpec) ([]uint16, []utls.TLSExtension) {
+	var ciphers []uint16
+	for _, cipher := range spec.CipherSuites {
+		if cipher&0x0f0f != 0x0a0a {
+			ciphers = append(ciphers, cipher)
+		}
+	}
+	var extensions []utls.TLSExtension
+	for _, extension := range spec.Extensions {
+		if _, ok := extension.(*utls.UtlsGREASEExtension); !ok {
+			extensions = append(extensions, extension)
+		}
+	}
+	return ciphers, extensions
+}
+
+// 生成的ClientHelloSpec使用JA4中的密码套件顺序、签名算法与ALPN
+func TestNewClientHelloSpecFromJA4(t *testing.T) {
+	spec, err := NewClientHelloSpecFromJA4(chromeJA4r, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphers, extensions := withoutGREASE(spec)
+	if want := []uint16{0x002f, 0x0035, 0x009c, 0x009d, 0x1301, 0x1302, 0x1303, 0xc013, 0xc014, 0xc02b, 0xc02c, 0xc02f, 0xc030, 0xcca8, 0xcca9}; !reflect.DeepEqual(ciphers, want) {
+		t.Errorf("cipher suites = %04x, want %04x", ciphers, want)
+	}
+	if len(extensions) != 16 {
+		t.Errorf("got %d extensions, want 16", len(extensions))
+	}
+	var sni, alpn, sigAlgs, versions bool
+	for _, extension := range extensions {
+		switch e := extension.(type) {
+		case *utls.SNIExtension:
+			sni = extensions[0] == extension
+		case *utls.ALPNExtension:
+			alpn = reflect.DeepEqual(e.AlpnProtocols, []string{"h2", "http/1.1"}) && extensions[1] == extension
+		case *utls.SignatureAlgorithmsExtension:
+			sigAlgs = reflect.DeepEqual(e.SupportedSignatureAlgorithms, []utls.SignatureScheme{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601})
+		case *utls.SupportedVersionsExtension:
+			versions = reflect.DeepEqual(e.Versions, []uint16{utls.VersionTLS13, utls.VersionTLS12})
+		}
+	}
+	if !sni || !alpn || !sigAlgs || !versions {
+		t.Errorf("sni = %v, alpn = %v, signature algorithms = %v, supported versions = %v", sni, alpn, sigAlgs, versions)
+	}
+
+	// JA4_ro中的密码套件不排序
+	spec, err = NewClientHelloSpecFromJA4("t13d0405h2_1301,c02b,1302,c02f_0000,002b,0010,000b,000a", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ciphers, _ = withoutGREASE(spec); !reflect.DeepEqual(ciphers, []uint16{0x1301, 0xc02b, 0x1302, 0xc02f}) {
+		t.Errorf("JA4_ro cipher suites = %04x", ciphers)
+	}
+	if _, err = NewClientHelloSpecFromJA4("t13d1516h2_8daaf6152771_b186095e22b6", "", nil, nil); err == nil {
+		t.Error("expected an error for a hashed JA4")
+	}
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"fmt"
+	utls "github.com/refraction-networking/utls"
+	http "github.com/wangluozhe/chttp"
+	"strconv"
+	"strings"
+)
+
+// 根据JA3字符串生成ClientHelloSpec，每次调用都会复制一份TLS扩展，
+// utls在ApplyPreset时会改写扩展中的GREASE值和KeyShare数据，共享同一份扩展会导致并发握手时数据竞争。
+// extra为nil时只使用tlsExtensions
+func NewClientHelloSpec(ja3, userAgent string, tlsExtensions *http.TLSExtensions, extra *ExtraExtensions) (*utls.ClientHelloSpec, error) {
+	if len(strings.Split(ja3, ",")) != 5 {
+		return nil, fmt.Errorf("invalid JA3 string %q: expected 5 comma separated fields", ja3)
+	}
+	spec, err := CloneTLSExtensions(tlsExtensions).StringToSpec(ja3, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	useNewALPS(spec, ja3)
+	if err = extra.apply(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// chttp将17613也生成为旧编号17513的application_settings，按JA3中的位置替换为utls新编号的扩展
+func useNewALPS(spec *utls.ClientHelloSpec, ja3 string) {
+	ids := strings.Split(strings.Split(ja3, ",")[2], "-")
+	i := 0
+	for j, extension := range spec.Extensions {
+		// chttp只在JA3的扩展之外添加GREASE扩展
+		if _, ok := extension.(*utls.UtlsGREASEExtension); ok {
+			continue
+		}
+		if alps, ok := extension.(*utls.ApplicationSettingsExtension); ok && i < len(ids) && ids[i] == "17613" {
+			spec.Extensions[j] = &utls.ApplicationSettingsExtensionNew{SupportedProtocols: append([]string(nil), alps.SupportedProtocols...)}
+		}
+		i++
+	}
+}
+
+// 严格校验JA3字符串，拒绝格式错误及无法解析的扩展编号，错误为*FieldError
+func ValidateJA3Strict(ja3 string) error {
+	fields := strings.Split(ja3, ",")
+	if len(fields) != 5 {
+		return fmt.Errorf("invalid JA3 string %q: expected 5 comma separated fields", ja3)
+	}
+	if fields[2] == "" {
+		return nil
+	}
+	for i, extension := range strings.Split(fields[2], "-") {
+		if _, err := strconv.ParseUint(extension, 10, 16); err != nil {
+			return fieldError("JA3.Extensions", i, extension, ErrUnknownValue)
+		}
+	}
+	return nil
+}
+
+// 深拷贝TLS扩展
+func CloneTLSExtensions(e *http.TLSExtensions) *http.TLSExtensions {
+	extensions := &http.TLSExtensions{}
+	if e == nil {
+		return extensions
+	}
+	if e.SupportedSignatureAlgorithms != nil {
+		extensions.SupportedSignatureAlgorithms = &utls.SignatureAlgorithmsExtension{
+			SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.SupportedSignatureAlgorithms.SupportedSignatureAlgorithms...),
+		}
+	}
+	if e.CertCompressionAlgo != nil {
+		extensions.CertCompressionAlgo = &utls.UtlsCompressCertExtension{
+			Algorithms: append([]utls.CertCompressionAlgo(nil), e.CertCompressionAlgo.Algorithms...),
+		}
+	}
+	if e.RecordSizeLimit != nil {
+		extensions.RecordSizeLimit = &utls.FakeRecordSizeLimitExtension{Limit: e.RecordSizeLimit.Limit}
+	}
+	if e.DelegatedCredentials != nil {
+		extensions.DelegatedCredentials = &utls.DelegatedCredentialsExtension{
+			SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.DelegatedCredentials.SupportedSignatureAlgorithms...),
+		}
+	}
+	if e.SupportedVersions != nil {
+		extensions.SupportedVersions = &utls.SupportedVersionsExtension{
+			Versions: append([]uint16(nil), e.SupportedVersions.Versions...),
+		}
+	}
+	if e.PSKKeyExchangeModes != nil {
+		extensions.PSKKeyExchangeModes = &utls.PSKKeyExchangeModesExtension{
+			Modes: append([]uint8(nil), e.PSKKeyExchangeModes.Modes...),
+		}
+	}
+	if e.SignatureAlgorithmsCert != nil {
+		extensions.SignatureAlgorithmsCert = &utls.SignatureAlgorithmsCertExtension{
+			SupportedSignatureAlgorithms: append([]utls.SignatureScheme(nil), e.SignatureAlgorithmsCert.SupportedSignatureAlgorithms...),
+		}
+	}
+	if e.KeyShareCurves != nil {
+		extensions.KeyShareCurves = &utls.KeyShareExtension{KeyShares: make([]utls.KeyShare, 0, len(e.KeyShareCurves.KeyShares))}
+		for _, keyShare := range e.KeyShareCurves.KeyShares {
+			// GREASE占位需要1字节数据，其余曲线的数据在握手时生成
+			var data []byte
+			v := keyShare.Group
+			if ((v >> 8) == v&0xff) && v&0xf == 0xa {
+				data = []byte{0}
+			}
+			extensions.KeyShareCurves.KeyShares = append(extensions.KeyShareCurves.KeyShares, utls.KeyShare{Group: keyShare.Group, Data: data})
+		}
+	}
+	extensions.NotUsedGREASE = e.NotUsedGREASE
+	return extensions
+}
+
+// 从ClientHello的ALPN扩展中移除指定协议，其余扩展保持不变
+func StripALPNProtocol(spec *utls.ClientHelloSpec, protocol string) {
+	for _, extension := range spec.Extensions {
+		alpn, ok := extension.(*utls.ALPNExtension)
+		if !ok {
+			continue
+		}
+		var protocols []string
+		for _, p := range alpn.AlpnProtocols {
+			if p != protocol {
+				protocols = append(protocols, p)
+			}
+		}
+		if len(protocols) == 0 {
+			protocols = []string{"http/1.1"}
+		}
+		alpn.AlpnProtocols = protocols
+	}
+}
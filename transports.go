@@ -0,0 +1,339 @@
+package requests
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	url2 "net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Transport的配置，内容相同的请求共享同一个Transport及其连接池
+type transportKey struct {
+	proxies            string
+	proxyHeaders       *http.Header
+	insecureSkipVerify bool
+	tlsConfig          *url.TLSConfig
+	cert               string
+	ja3                string
+	ja4                string
+	userAgent          string
+	tlsExtensions      *http.TLSExtensions
+	extra              *transport.ExtraExtensions
+	http2Settings      *http.HTTP2Settings
+	forceHTTP1         bool
+	forceHTTP2         bool
+	useHTTP2           bool // 由指纹设置推断，不参与比较
+	pool               url.Pool
+	proxyPool          *url.ProxyPool // proxies所属的代理池，不参与比较，代理被移出代理池后释放Transport
+}
+
+const (
+	defaultIdleConnTimeout = 90 * time.Second // Pool.IdleConnTimeout为0时的空闲连接关闭时间
+	defaultMaxTransports   = 64               // Pool.MaxTransports为0时缓存的Transport数量上限
+	transportSweepInterval = time.Second      // 检查Transport的代理是否已移出代理池的最短间隔
+)
+
+// 计算配置的缓存键，按内容而不是指针比较，内容相同的配置共享同一个Transport
+func (key *transportKey) id() (string, error) {
+	var verify string
+	if key.tlsConfig != nil && key.tlsConfig.VerifyPeerCertificate != nil {
+		// 函数无法比较内容，按函数地址区分
+		verify = fmt.Sprintf("%p", key.tlsConfig.VerifyPeerCertificate)
+	}
+	data, err := json.Marshal([]interface{}{
+		key.proxies, key.proxyHeaders, key.insecureSkipVerify, key.tlsConfig, verify, key.cert,
+		key.ja3, key.ja4, key.userAgent, key.tlsExtensions, key.extra, key.http2Settings,
+		key.forceHTTP1, key.forceHTTP2, key.pool,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return string(sum[:]), nil
+}
+
+// 深拷贝配置中的指针，Transport不受调用方之后修改配置的影响
+func (key transportKey) clone() transportKey {
+	if key.proxyHeaders != nil {
+		headers := key.proxyHeaders.Clone()
+		key.proxyHeaders = &headers
+	}
+	if key.tlsConfig != nil {
+		config := *key.tlsConfig
+		config.RootCAs = slices.Clone(config.RootCAs)
+		config.ClientCert = slices.Clone(config.ClientCert)
+		config.ClientKey = slices.Clone(config.ClientKey)
+		config.PKCS12 = slices.Clone(config.PKCS12)
+		config.PinnedSPKI = slices.Clone(config.PinnedSPKI)
+		key.tlsConfig = &config
+	}
+	if key.tlsExtensions != nil {
+		key.tlsExtensions = transport.CloneTLSExtensions(key.tlsExtensions)
+	}
+	if key.extra != nil {
+		extra := *key.extra
+		extra.ALPN = slices.Clone(extra.ALPN)
+		extra.ALPS = slices.Clone(extra.ALPS)
+		if extra.ECH != nil {
+			extra.ECH = &transport.ECHGrease{
+				CipherSuites:   slices.Clone(extra.ECH.CipherSuites),
+				ConfigIDs:      slices.Clone(extra.ECH.ConfigIDs),
+				PayloadLengths: slices.Clone(extra.ECH.PayloadLengths),
+			}
+		}
+		key.extra = &extra
+	}
+	if key.http2Settings != nil {
+		settings := *key.http2Settings
+		settings.Settings = slices.Clone(settings.Settings)
+		settings.PriorityFrames = slices.Clone(settings.PriorityFrames)
+		if settings.HeaderPriority != nil {
+			priority := *settings.HeaderPriority
+			settings.HeaderPriority = &priority
+		}
+		key.http2Settings = &settings
+	}
+	return key
+}
+
+// 缓存的Transport，按最近使用的顺序排列
+type transportEntry struct {
+	id          string
+	transport   *http.Transport
+	idleTimeout time.Duration // 超过该时长未使用时释放，为0时不释放
+	lastUsed    time.Time
+	proxyPool   *url.ProxyPool // 代理所属的代理池，代理被移出后释放
+	proxy       string
+}
+
+// Transport缓存，数量超过上限、长时间未使用或代理被移出代理池时释放，释放时关闭空闲连接
+type transportCache struct {
+	entries map[string]*list.Element
+	lru     list.List // 最近使用的在前
+	swept   time.Time // 上次清理的时间
+}
+
+// 获取缓存的Transport并标记为最近使用，不存在时返回nil
+func (c *transportCache) get(id string, now time.Time) *http.Transport {
+	element, ok := c.entries[id]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*transportEntry)
+	entry.lastUsed = now
+	c.lru.MoveToFront(element)
+	return entry.transport
+}
+
+// 加入新建的Transport
+func (c *transportCache) add(entry *transportEntry) {
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	c.entries[entry.id] = c.lru.PushFront(entry)
+}
+
+// 释放超出数量上限的最久未使用的Transport，maxTransports小于0时不限制数量
+func (c *transportCache) evict(maxTransports int) {
+	for maxTransports >= 0 && c.lru.Len() > maxTransports {
+		c.remove(c.lru.Back())
+	}
+}
+
+// 释放超过空闲时长未使用的Transport，以及代理已被移出代理池的Transport，代理池每隔transportSweepInterval检查一次
+func (c *transportCache) sweep(now time.Time) {
+	checkPool := now.Sub(c.swept) >= transportSweepInterval
+	if checkPool {
+		c.swept = now
+	}
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*transportEntry)
+		if (entry.idleTimeout > 0 && now.Sub(entry.lastUsed) > entry.idleTimeout) ||
+			(checkPool && entry.proxyPool != nil && !entry.proxyPool.Contains(entry.proxy)) {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// 移除Transport并关闭其空闲连接，使用中的连接在请求结束后按IdleConnTimeout关闭
+func (c *transportCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*transportEntry)
+	delete(c.entries, entry.id)
+	entry.transport.CloseIdleConnections()
+}
+
+// 移除全部Transport，返回移除的Transport
+func (c *transportCache) clear() []*http.Transport {
+	var transports []*http.Transport
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		transports = append(transports, element.Value.(*transportEntry).transport)
+	}
+	c.entries = nil
+	c.lru.Init()
+	return transports
+}
+
+// 获取配置对应的Transport，不存在时新建，同时释放长时间未使用或超出数量上限的Transport
+func (s *Session) getTransport(key transportKey) (*http.Transport, error) {
+	id, err := key.id()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.transports.sweep(now)
+	if t := s.transports.get(id, now); t != nil {
+		return t, nil
+	}
+	key = key.clone()
+	t, err := newTransport(key, &s.stats)
+	if err != nil {
+		return nil, err
+	}
+	entry := &transportEntry{id: id, transport: t, lastUsed: now, proxyPool: key.proxyPool, proxy: key.proxies}
+	if t.IdleConnTimeout > 0 {
+		entry.idleTimeout = t.IdleConnTimeout
+	}
+	s.transports.add(entry)
+	maxTransports := key.pool.MaxTransports
+	if maxTransports == 0 {
+		maxTransports = defaultMaxTransports
+	}
+	s.transports.evict(maxTransports)
+	return t, nil
+}
+
+// 获取Session连接池的统计快照
+func (s *Session) Stats() *SessionStats {
+	return s.stats.snapshot()
+}
+
+// 关闭全部空闲连接，正在处理请求的连接不受影响
+func (s *Session) CloseIdleConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for element := s.transports.lru.Front(); element != nil; element = element.Next() {
+		element.Value.(*transportEntry).transport.CloseIdleConnections()
+	}
+}
+
+// 关闭全部连接并释放Transport，进行中的请求会失败，之后的请求会重新建立连接。
+// 设置了PersistCookies时同时保存尚未保存的Cookie，返回保存的错误
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	transports := s.transports.clear()
+	s.mutex.Unlock()
+	for _, t := range transports {
+		t.CloseIdleConnections()
+	}
+	s.stats.closeAll()
+	return s.FlushCookies()
+}
+
+// 根据配置新建Transport，建立的连接记录到stats
+func newTransport(key transportKey, stats *connStats) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(key)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dialer{
+		tlsConfig:     tlsConfig,
+		ja3:           key.ja3,
+		ja4:           key.ja4,
+		userAgent:     key.userAgent,
+		tlsExtensions: key.tlsExtensions,
+		extra:         key.extra,
+		proxyHeaders:  key.proxyHeaders,
+		forceHTTP1:    key.forceHTTP1,
+		forceHTTP2:    key.forceHTTP2,
+		stats:         stats,
+	}
+
+	// 设置代理
+	if key.proxies != "" {
+		u, err := url2.Parse(key.proxies)
+		if err != nil {
+			return nil, err
+		}
+		d.proxy = u
+	}
+
+	idleConnTimeout := key.pool.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+	t := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		DisableKeepAlives:   key.pool.DisableKeepAlives,
+		MaxIdleConns:        key.pool.MaxIdleConns,
+		MaxIdleConnsPerHost: key.pool.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     key.pool.MaxConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		Proxy:               d.proxyFunc,
+		DialContext:         d.dialContext,
+		DialTLSContext:      d.dialTLSContext,
+	}
+
+	// 设置JA3指纹信息，JA4指纹转换为等价的JA3后处理
+	ja3 := key.ja3
+	if key.ja4 != "" {
+		spec, err := transport.ParseJA4(key.ja4)
+		if err != nil {
+			return nil, err
+		}
+		ja3 = spec.JA3
+	}
+	if ja3 != "" {
+		fields := strings.Split(ja3, ",")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid JA3 string %q: expected 5 comma separated fields", ja3)
+		}
+		if strings.Index(fields[2], "-41") != -1 {
+			tlsConfig.SessionTicketsDisabled = false
+		}
+		if key.extra != nil && key.extra.PreSharedKey {
+			tlsConfig.SessionTicketsDisabled = false
+		}
+	}
+
+	// 配置HTTP2，是否使用由FingerprintSettings推断
+	if key.useHTTP2 {
+		h2, err := http.HTTP2ConfigureTransports(t)
+		if err != nil {
+			return nil, err
+		}
+		h2.StrictMaxConcurrentStreams = key.pool.StrictMaxConcurrentStreams
+		h2.ReadIdleTimeout = key.pool.ReadIdleTimeout
+		h2.PingTimeout = key.pool.PingTimeout
+		// 自定义HTTP2指纹信息
+		h2.HTTP2Settings = key.http2Settings
+		if key.http2Settings != nil {
+			for _, setting := range key.http2Settings.Settings {
+				switch setting.ID {
+				case http.HTTP2SettingHeaderTableSize:
+					h2.MaxEncoderHeaderTableSize = setting.Val
+					h2.MaxDecoderHeaderTableSize = setting.Val
+				case http.HTTP2SettingMaxConcurrentStreams:
+					h2.StrictMaxConcurrentStreams = true
+				case http.HTTP2SettingMaxFrameSize:
+					h2.MaxReadFrameSize = setting.Val
+				case http.HTTP2SettingMaxHeaderListSize:
+					h2.MaxHeaderListSize = setting.Val
+				}
+			}
+		}
+		t.H2Transport = h2
+	}
+	return t, nil
+}
@@ -0,0 +1,201 @@
+package requests
+
+import (
+	"encoding/pem"
+	"fmt"
+	"github.com/wangluozhe/chttp"
+	"github.com/wangluozhe/requests/transport"
+	"github.com/wangluozhe/requests/url"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testJA3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513,29-23-24,0"
+
+func newTestServer(t *testing.T) (*httptest.Server, []byte) {
+	server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+func transportCount(s *Session) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.transports.lru.Len()
+}
+
+// 每次请求新建的内容相同的配置共享同一个Transport
+func TestTransportSharedAcrossEquivalentConfigs(t *testing.T) {
+	server, ca := newTestServer(t)
+	session := NewSession()
+	defer session.Close()
+	session.Ja3 = testJA3
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tlsExtensions, err := transport.ToTLSExtensions(&transport.Extensions{SupportedVersions: []string{"1.3", "1.2"}})
+			if err != nil {
+				errs <- err
+				return
+			}
+			headers := http.Header{"X-Proxy": {"a"}}
+			req := url.NewRequest()
+			req.TLSConfig = &url.TLSConfig{RootCAs: ca}
+			req.TLSExtensions = tlsExtensions
+			req.ExtraExtensions = &transport.ExtraExtensions{ALPN: []string{"h2", "http/1.1"}}
+			req.HTTP2Settings = &http.HTTP2Settings{Settings: []http.HTTP2Setting{{ID: http.HTTP2SettingInitialWindowSize, Val: 6291456}}}
+			req.ProxyHeaders = &headers
+			r, err := session.Get(server.URL, req)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if r.Text != "HTTP/2.0" {
+				errs <- fmt.Errorf("proto = %s, want HTTP/2.0", r.Text)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if n := transportCount(session); n != 1 {
+		t.Fatalf("transports = %d, want 1", n)
+	}
+}
+
+// 修改已使用的配置不影响已建立的Transport，修改后的配置使用新的Transport
+func TestTransportKeyCopiesConfig(t *testing.T) {
+	server, ca := newTestServer(t)
+	session := NewSession()
+	defer session.Close()
+	session.TLSConfig = &url.TLSConfig{RootCAs: ca}
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	session.TLSConfig.ServerName = "example.com"
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	session.TLSConfig.ServerName = ""
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := transportCount(session); n != 2 {
+		t.Fatalf("transports = %d, want 2", n)
+	}
+}
+
+// 超出MaxTransports时释放最久未使用的Transport
+func TestTransportCacheLimit(t *testing.T) {
+	server, ca := newTestServer(t)
+	session := NewSession()
+	defer session.Close()
+	session.TLSConfig = &url.TLSConfig{RootCAs: ca}
+	session.Pool = &url.Pool{MaxTransports: 2}
+	for i := 0; i < 5; i++ {
+		req := url.NewRequest()
+		req.ProxyHeaders = &http.Header{"X-Id": {fmt.Sprint(i)}}
+		if _, err := session.Get(server.URL, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := transportCount(session); n != 2 {
+		t.Fatalf("transports = %d, want 2", n)
+	}
+	stats := session.Stats()
+	if stats.Idle > 2 {
+		t.Fatalf("idle connections = %d, want at most 2", stats.Idle)
+	}
+}
+
+// 超过IdleConnTimeout未使用的Transport被释放
+func TestTransportIdleEviction(t *testing.T) {
+	server, ca := newTestServer(t)
+	session := NewSession()
+	defer session.Close()
+	session.TLSConfig = &url.TLSConfig{RootCAs: ca}
+	session.Pool = &url.Pool{IdleConnTimeout: 50 * time.Millisecond}
+	if _, err := session.Get(server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	req := url.NewRequest()
+	req.ProxyHeaders = &http.Header{"X-Id": {"new"}}
+	if _, err := session.Get(server.URL, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := transportCount(session); n != 1 {
+		t.Fatalf("transports = %d, want 1", n)
+	}
+}
+
+// Pool各字段为0时空闲连接按默认时间关闭
+func TestDefaultIdleConnTimeout(t *testing.T) {
+	for _, c := range []struct {
+		pool *url.Pool
+		want time.Duration
+	}{
+		{nil, defaultIdleConnTimeout},
+		{&url.Pool{MaxConnsPerHost: 10}, defaultIdleConnTimeout},
+		{&url.Pool{IdleConnTimeout: time.Second}, time.Second},
+		{&url.Pool{IdleConnTimeout: -1}, -1},
+	} {
+		var key transportKey
+		if c.pool != nil {
+			key.pool = *c.pool
+		}
+		tr, err := newTransport(key, &connStats{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr.IdleConnTimeout != c.want {
+			t.Errorf("pool %+v: IdleConnTimeout = %v, want %v", c.pool, tr.IdleConnTimeout, c.want)
+		}
+	}
+}
+
+// 并发请求、关闭空闲连接与关闭Session
+func TestTransportConcurrentClose(t *testing.T) {
+	server, ca := newTestServer(t)
+	session := NewSession()
+	session.TLSConfig = &url.TLSConfig{RootCAs: ca}
+	session.Pool = &url.Pool{MaxTransports: 3}
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := url.NewRequest()
+			req.ProxyHeaders = &http.Header{"X-Id": {fmt.Sprint(i % 5)}}
+			if i%2 == 0 {
+				req.Ja3 = testJA3
+			}
+			session.Get(server.URL, req)
+			switch i % 10 {
+			case 3:
+				session.CloseIdleConnections()
+			case 7:
+				session.Close()
+			}
+			session.Stats()
+		}(i)
+	}
+	wg.Wait()
+	session.Close()
+	if n := transportCount(session); n != 0 {
+		t.Fatalf("transports = %d after Close, want 0", n)
+	}
+}
@@ -0,0 +1,27 @@
+package url
+
+import "time"
+
+// 初始化Pool结构体
+func NewPool() *Pool {
+	return &Pool{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// 连接池配置，作用于Session的全部连接，各字段为0时使用默认值
+type Pool struct {
+	MaxIdleConns               int           // 全部主机的最大空闲连接数，为0时不限制
+	MaxIdleConnsPerHost        int           // 每个主机的最大空闲连接数，为0时为2
+	MaxConnsPerHost            int           // 每个主机的最大连接数，包含拨号中、使用中与空闲的连接，为0时不限制
+	IdleConnTimeout            time.Duration // 空闲连接的关闭时间，为0时为90秒，小于0时不关闭
+	DisableKeepAlives          bool          // 每个请求使用新的连接，请求结束后关闭
+	StrictMaxConcurrentStreams bool          // HTTP2连接达到服务器的并发流上限时等待，而不是新建连接
+	ReadIdleTimeout            time.Duration // HTTP2连接多久没有收到帧时发送PING检查连接，为0时不检查
+	PingTimeout                time.Duration // HTTP2 PING的响应超时，超时后关闭连接，为0时为15秒
+	// 缓存的Transport数量上限，超出时释放最久未使用的Transport，为0时为64，小于0时不限制。
+	// 超过IdleConnTimeout未使用的Transport也会被释放
+	MaxTransports int
+}
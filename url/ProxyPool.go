@@ -0,0 +1,309 @@
+package url
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 代理选择策略
+type ProxyStrategy int
+
+const (
+	RoundRobin    ProxyStrategy = iota // 轮询
+	Random                             // 随机
+	LeastUsed                          // 使用次数最少
+	StickyPerHost                      // 同一主机固定使用同一代理，代理被淘汰后重新分配
+)
+
+// StickyTTL为0时主机与代理绑定的保留时间
+const defaultStickyTTL = 10 * time.Minute
+
+// 没有可用代理
+var ErrNoProxyAvailable = errors.New("no proxy available in pool")
+
+// 初始化ProxyPool结构体，默认使用轮询策略
+func NewProxyPool(proxies ...string) *ProxyPool {
+	pool := &ProxyPool{
+		Strategy:    RoundRobin,
+		MaxFailures: 3,
+		Cooldown:    time.Minute,
+	}
+	for _, proxy := range proxies {
+		pool.Add(proxy)
+	}
+	return pool
+}
+
+// 以函数提供代理列表的代理池，每隔interval重新获取一次，interval为0时只获取一次
+func NewProxyPoolWithProvider(provider func() ([]string, error), interval time.Duration) *ProxyPool {
+	pool := NewProxyPool()
+	pool.Provider = provider
+	pool.RefreshInterval = interval
+	return pool
+}
+
+// 代理池，可在多个goroutine中并发使用
+type ProxyPool struct {
+	Strategy        ProxyStrategy
+	MaxFailures     int                      // 连续失败多少次后淘汰代理，为0时不淘汰
+	Cooldown        time.Duration            // 被淘汰的代理在冷却时间后重新启用
+	Provider        func() ([]string, error) // 代理列表提供函数
+	RefreshInterval time.Duration            // 重新调用Provider的间隔
+	StickyTTL       time.Duration            // StickyPerHost策略下主机多久没有请求后解除绑定，为0时为10分钟
+
+	mutex        sync.Mutex
+	refreshMutex sync.Mutex // 保证同一时间只有一个goroutine调用Provider
+	proxies      []*proxyState
+	next         int
+	sticky       map[string]*stickyProxy
+	swept        time.Time // 上次清理过期绑定的时间
+	refreshed    time.Time
+}
+
+// 主机绑定的代理
+type stickyProxy struct {
+	state    *proxyState
+	lastUsed time.Time
+}
+
+// 代理状态
+type proxyState struct {
+	proxy         string
+	used          int
+	failures      int
+	disabledUntil time.Time
+}
+
+// 代理是否可用
+func (ps *proxyState) available(now time.Time) bool {
+	return !now.Before(ps.disabledUntil)
+}
+
+// 添加代理，已存在时不做处理
+func (p *ProxyPool) Add(proxy string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.find(proxy) == nil {
+		p.proxies = append(p.proxies, &proxyState{proxy: proxy})
+	}
+}
+
+// 移除代理
+func (p *ProxyPool) Remove(proxy string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, ps := range p.proxies {
+		if ps.proxy == proxy {
+			p.proxies = append(p.proxies[:i:i], p.proxies[i+1:]...)
+			break
+		}
+	}
+	for host, sticky := range p.sticky {
+		if sticky.state.proxy == proxy {
+			delete(p.sticky, host)
+		}
+	}
+}
+
+// 代理是否在代理池中，包括冷却中的代理
+func (p *ProxyPool) Contains(proxy string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.find(proxy) != nil
+}
+
+// 所有代理，包括冷却中的代理
+func (p *ProxyPool) Proxies() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	proxies := make([]string, 0, len(p.proxies))
+	for _, ps := range p.proxies {
+		proxies = append(proxies, ps.proxy)
+	}
+	return proxies
+}
+
+// 当前可用的代理
+func (p *ProxyPool) Available() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	var proxies []string
+	for _, ps := range p.proxies {
+		if ps.available(now) {
+			proxies = append(proxies, ps.proxy)
+		}
+	}
+	return proxies
+}
+
+// 为访问host的请求选择一个代理
+func (p *ProxyPool) Pick(host string) (string, error) {
+	if err := p.refresh(); err != nil {
+		return "", err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	var available []*proxyState
+	for _, ps := range p.proxies {
+		if ps.available(now) {
+			available = append(available, ps)
+		}
+	}
+	if len(available) == 0 {
+		return "", ErrNoProxyAvailable
+	}
+
+	var picked *proxyState
+	switch p.Strategy {
+	case Random:
+		picked = available[rand.Intn(len(available))]
+	case LeastUsed:
+		picked = available[0]
+		for _, ps := range available[1:] {
+			if ps.used < picked.used {
+				picked = ps
+			}
+		}
+	case StickyPerHost:
+		p.sweepSticky(now)
+		if sticky, ok := p.sticky[host]; ok && sticky.state.available(now) && p.find(sticky.state.proxy) == sticky.state {
+			picked = sticky.state
+			sticky.lastUsed = now
+		} else {
+			picked = available[p.next%len(available)]
+			p.next++
+			if p.sticky == nil {
+				p.sticky = make(map[string]*stickyProxy)
+			}
+			p.sticky[host] = &stickyProxy{state: picked, lastUsed: now}
+		}
+	default:
+		picked = available[p.next%len(available)]
+		p.next++
+	}
+	picked.used++
+	return picked.proxy, nil
+}
+
+// 记录代理请求成功，清空连续失败次数
+func (p *ProxyPool) MarkSuccess(proxy string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ps := p.find(proxy); ps != nil {
+		ps.failures = 0
+	}
+}
+
+// 记录代理请求失败，连续失败达到MaxFailures时淘汰该代理
+func (p *ProxyPool) MarkFailure(proxy string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ps := p.find(proxy)
+	if ps == nil {
+		return
+	}
+	ps.failures++
+	if p.MaxFailures > 0 && ps.failures >= p.MaxFailures {
+		ps.failures = 0
+		ps.disabledUntil = time.Now().Add(p.Cooldown)
+		for host, sticky := range p.sticky {
+			if sticky.state == ps {
+				delete(p.sticky, host)
+			}
+		}
+	}
+}
+
+// 解除超过StickyTTL没有请求的主机绑定，每隔StickyTTL的一半清理一次
+func (p *ProxyPool) sweepSticky(now time.Time) {
+	ttl := p.StickyTTL
+	if ttl <= 0 {
+		ttl = defaultStickyTTL
+	}
+	if now.Sub(p.swept) < ttl/2 {
+		return
+	}
+	p.swept = now
+	for host, sticky := range p.sticky {
+		if now.Sub(sticky.lastUsed) > ttl {
+			delete(p.sticky, host)
+		}
+	}
+}
+
+// 是否需要重新获取代理列表
+func (p *ProxyPool) refreshDue() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.refreshed.IsZero() || (p.RefreshInterval > 0 && time.Since(p.refreshed) >= p.RefreshInterval)
+}
+
+// 按RefreshInterval从Provider重新获取代理列表，保留已有代理的状态。
+// Provider在锁外调用，刷新期间已有代理时其余请求继续使用旧列表
+func (p *ProxyPool) refresh() error {
+	if p.Provider == nil || !p.refreshDue() {
+		return nil
+	}
+	if !p.refreshMutex.TryLock() {
+		p.mutex.Lock()
+		empty := len(p.proxies) == 0
+		p.mutex.Unlock()
+		if !empty {
+			return nil
+		}
+		// 没有可用的旧列表，等待正在进行的刷新
+		p.refreshMutex.Lock()
+	}
+	defer p.refreshMutex.Unlock()
+	if !p.refreshDue() {
+		return nil
+	}
+	proxies, err := p.Provider()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		// 已有代理时继续使用旧列表，等待下次刷新
+		if len(p.proxies) != 0 {
+			p.refreshed = time.Now()
+			return nil
+		}
+		return err
+	}
+	p.refreshed = time.Now()
+	states := make([]*proxyState, 0, len(proxies))
+	kept := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		if kept[proxy] {
+			continue
+		}
+		kept[proxy] = true
+		ps := p.find(proxy)
+		if ps == nil {
+			ps = &proxyState{proxy: proxy}
+		}
+		states = append(states, ps)
+	}
+	p.proxies = states
+	// 解除已移除代理的主机绑定
+	for host, sticky := range p.sticky {
+		if !kept[sticky.state.proxy] {
+			delete(p.sticky, host)
+		}
+	}
+	return nil
+}
+
+func (p *ProxyPool) find(proxy string) *proxyState {
+	for _, ps := range p.proxies {
+		if ps.proxy == proxy {
+			return ps
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package url
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 刷新时Provider在锁外调用，已有代理时其余请求不等待Provider返回
+func TestProxyPoolRefreshDoesNotBlockPick(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	pool := NewProxyPoolWithProvider(func() ([]string, error) {
+		if calls.Add(1) > 1 {
+			<-release
+		}
+		return []string{"http://127.0.0.1:8001"}, nil
+	}, time.Millisecond)
+	if _, err := pool.Pick("a.com"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	refreshing := make(chan struct{})
+	go func() {
+		defer close(refreshing)
+		pool.Pick("a.com")
+	}()
+	for calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if _, err := pool.Pick("b.com"); err != nil {
+				t.Error(err)
+			}
+			pool.MarkSuccess("http://127.0.0.1:8001")
+			pool.Available()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Pick blocked while Provider was running")
+	}
+	close(release)
+	<-refreshing
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("Provider called %d times, want 2", n)
+	}
+}
+
+// 没有代理时等待正在进行的刷新，Provider只调用一次
+func TestProxyPoolConcurrentFirstRefresh(t *testing.T) {
+	var calls atomic.Int32
+	pool := NewProxyPoolWithProvider(func() ([]string, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return []string{"http://127.0.0.1:8001", "http://127.0.0.1:8002"}, nil
+	}, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Pick("a.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Provider called %d times, want 1", n)
+	}
+}
+
+// 刷新移除代理时解除其主机绑定
+func TestProxyPoolRefreshPrunesSticky(t *testing.T) {
+	list := []string{"http://127.0.0.1:8001"}
+	pool := NewProxyPoolWithProvider(func() ([]string, error) {
+		return list, nil
+	}, time.Millisecond)
+	pool.Strategy = StickyPerHost
+	if proxy, _ := pool.Pick("a.com"); proxy != "http://127.0.0.1:8001" {
+		t.Fatalf("picked %s", proxy)
+	}
+	list = []string{"http://127.0.0.1:8002", "http://127.0.0.1:8002"}
+	time.Sleep(5 * time.Millisecond)
+	if proxy, _ := pool.Pick("b.com"); proxy != "http://127.0.0.1:8002" {
+		t.Fatalf("picked %s", proxy)
+	}
+	if _, ok := pool.sticky["a.com"]; ok {
+		t.Fatal("binding of removed proxy was kept")
+	}
+	if proxies := pool.Proxies(); len(proxies) != 1 {
+		t.Fatalf("proxies = %v, want one entry", proxies)
+	}
+}
+
+// 超过StickyTTL没有请求的主机绑定被清理
+func TestProxyPoolStickyTTL(t *testing.T) {
+	pool := NewProxyPool("http://127.0.0.1:8001", "http://127.0.0.1:8002")
+	pool.Strategy = StickyPerHost
+	pool.StickyTTL = 20 * time.Millisecond
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		pool.Pick(host)
+	}
+	time.Sleep(30 * time.Millisecond)
+	pool.Pick("d.com")
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if len(pool.sticky) != 1 {
+		t.Fatalf("sticky = %d entries, want 1", len(pool.sticky))
+	}
+}
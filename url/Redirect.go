@@ -0,0 +1,60 @@
+package url
+
+import (
+	"errors"
+	http "github.com/wangluozhe/chttp"
+)
+
+// 重定向策略拒绝跟随时返回的错误，可用errors.Is判断
+var (
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrRedirectHost      = errors.New("redirect to another host is not allowed")
+	ErrRedirectDowngrade = errors.New("redirect from https to http is not allowed")
+)
+
+// 301、302、303重定向时改写请求方法的规则，改写后的请求为GET且不带请求体，307、308始终保持原请求方法与请求体
+type RedirectRewrite int
+
+const (
+	RewriteBrowser RedirectRewrite = iota // 与浏览器相同，301、302的POST请求与303的非GET、HEAD请求改为GET
+	RewriteAlways                         // 301、302、303的非HEAD请求都改为GET
+	RewriteNever                          // 保持原请求方法与请求体
+)
+
+// 初始化Redirect结构体
+func NewRedirect() *Redirect {
+	return &Redirect{
+		MaxRedirects:    30,
+		ForbidDowngrade: true,
+	}
+}
+
+// 重定向策略，只作用于当次请求，跟随重定向需要Request.AllowRedirects为true
+type Redirect struct {
+	MaxRedirects         int             // 最大重定向次数，为0时使用Session.MaxRedirects
+	SameHostOnly         bool            // 只允许重定向到与首个请求相同的主机
+	ForbidDowngrade      bool            // 禁止从https重定向到http
+	KeepSensitiveHeaders bool            // 重定向到其他源时保留Authorization与Cookie请求头，默认删除
+	Rewrite              RedirectRewrite // 301、302、303重定向时改写请求方法的规则
+	Referer              bool            // 与浏览器相同，将Referer设置为上一个请求的地址，https重定向到http时不发送
+}
+
+// 获取重定向后的请求方法
+func (r *Redirect) Method(statusCode int, method string) string {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+	default:
+		return method
+	}
+	switch r.Rewrite {
+	case RewriteAlways:
+		if method != http.MethodHead {
+			return http.MethodGet
+		}
+	case RewriteBrowser:
+		if statusCode == http.StatusSeeOther && method != http.MethodHead || method == http.MethodPost {
+			return http.MethodGet
+		}
+	}
+	return method
+}
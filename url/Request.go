@@ -1,8 +1,10 @@
 package url
 
 import (
+	"context"
 	"github.com/wangluozhe/chttp"
 	"github.com/wangluozhe/chttp/cookiejar"
+	"github.com/wangluozhe/requests/transport"
 	"io"
 	"time"
 )
@@ -23,13 +25,26 @@ type Request struct {
 	Json           map[string]interface{}
 	Body           io.Reader
 	Auth           []string
-	Timeout        time.Duration
+	Timeout        time.Duration // 整个请求的超时，等同于Timeouts.Total，流式响应只计算到收到响应头
+	Timeouts       *Timeouts     // 分阶段的超时设置，不为0的字段覆盖Session中的设置
 	AllowRedirects bool
+	Redirect       *Redirect // 重定向策略，不为nil时替换Session的Redirect
 	Proxies        string
-	Verify         bool
-	Cert           []string
-	Ja3            string
-	ForceHTTP1     bool
-	TLSExtensions  *http.TLSExtensions
-	HTTP2Settings  *http.HTTP2Settings
+	ProxyPool      *ProxyPool   // 设置Proxies时不使用代理池
+	ProxyHeaders   *http.Header // 通过代理建立隧道时CONNECT请求附带的请求头，支持Header-Order:排序
+	// Deprecated: 该字段不再生效，零值的Request无法与显式设置的false区分。跳过证书校验请使用InsecureSkipVerify。
+	Verify             bool
+	InsecureSkipVerify bool // 跳过服务器证书校验
+	Cert               []string
+	TLSConfig          *TLSConfig // 不为nil时替换Session的TLSConfig
+	Ja3                string
+	Ja4                string // JA4_r或JA4_ro字符串，与Ja3二选一
+	ForceHTTP1         bool
+	ForceHTTP2         bool
+	Stream             bool
+	Retry              *Retry
+	TLSExtensions      *http.TLSExtensions
+	ExtraExtensions    *transport.ExtraExtensions // ALPN、ECH等额外设置，与TLSExtensions任一不为nil时整体替换Session中的设置
+	HTTP2Settings      *http.HTTP2Settings
+	Context            context.Context // 可用models.WithMiddlewares附带只作用于本次请求的中间件
 }
@@ -0,0 +1,114 @@
+package url
+
+import (
+	http "github.com/wangluozhe/chttp"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 可重试的错误类型
+type RetryError int
+
+const (
+	RetryConnectError RetryError = 1 << iota // 建立连接失败
+	RetryTLSError                            // TLS握手失败（证书校验失败除外）
+	RetryTimeoutError                        // 连接、握手或响应超时
+	RetryResetError                          // 连接被重置或意外关闭
+	RetryAllErrors    = RetryConnectError | RetryTLSError | RetryTimeoutError | RetryResetError
+)
+
+// 默认允许重试的幂等请求方法
+var DefaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace}
+
+// 默认重试的状态码
+var DefaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// 初始化Retry结构体
+func NewRetry() *Retry {
+	return &Retry{
+		MaxAttempts:       3,
+		StatusCodes:       DefaultRetryStatusCodes,
+		Errors:            RetryAllErrors,
+		Methods:           DefaultRetryMethods,
+		BackoffFactor:     500 * time.Millisecond,
+		BackoffMax:        30 * time.Second,
+		BackoffJitter:     250 * time.Millisecond,
+		RespectRetryAfter: true,
+	}
+}
+
+// Retry结构体，第n次重试前等待 BackoffFactor * 2^(n-1) + [0, BackoffJitter) 的随机时间，最长BackoffMax
+type Retry struct {
+	MaxAttempts       int           // 最大尝试次数，包含首次请求
+	StatusCodes       []int         // 需要重试的状态码
+	Errors            RetryError    // 需要重试的错误类型
+	Methods           []string      // 允许重试的请求方法，为空时使用DefaultRetryMethods
+	BackoffFactor     time.Duration // 退避基数
+	BackoffMax        time.Duration // 最长退避时间，为0时不限制
+	BackoffJitter     time.Duration // 随机抖动上限
+	RespectRetryAfter bool          // 是否遵循响应的Retry-After头
+}
+
+// 请求方法是否允许重试
+func (r *Retry) AllowMethod(method string) bool {
+	methods := r.Methods
+	if methods == nil {
+		methods = DefaultRetryMethods
+	}
+	return SearchStrings(methods, strings.ToUpper(method)) != -1
+}
+
+// 状态码是否需要重试
+func (r *Retry) AllowStatus(statusCode int) bool {
+	for _, code := range r.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// 第attempt次请求失败后的等待时间，header为该次请求的响应头，可为nil
+func (r *Retry) Delay(attempt int, header http.Header) time.Duration {
+	if r.RespectRetryAfter && header != nil {
+		if delay, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			return delay
+		}
+	}
+	shift := attempt - 1
+	if shift > 30 {
+		shift = 30
+	}
+	delay := r.BackoffFactor << shift
+	if delay < 0 || (r.BackoffMax > 0 && delay > r.BackoffMax) {
+		delay = r.BackoffMax
+	}
+	if r.BackoffJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(r.BackoffJitter)))
+	}
+	return delay
+}
+
+// 解析Retry-After头，支持秒数与HTTP日期两种格式
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
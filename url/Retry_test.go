@@ -0,0 +1,77 @@
+package url
+
+import (
+	http "github.com/wangluozhe/chttp"
+	"testing"
+	"time"
+)
+
+// 退避时间按BackoffFactor翻倍，不超过BackoffMax，抖动在[0, BackoffJitter)之间
+func TestRetryDelayBackoff(t *testing.T) {
+	retry := &Retry{BackoffFactor: 100 * time.Millisecond, BackoffMax: time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		40: time.Second,
+	} {
+		if delay := retry.Delay(attempt, nil); delay != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, delay, want)
+		}
+	}
+	retry.BackoffMax = 0
+	if delay := retry.Delay(40, nil); delay != 100*time.Millisecond<<30 {
+		t.Errorf("unbounded Delay(40) = %s", delay)
+	}
+
+	retry = &Retry{BackoffFactor: 100 * time.Millisecond, BackoffJitter: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if delay := retry.Delay(1, nil); delay < 100*time.Millisecond || delay >= 150*time.Millisecond {
+			t.Fatalf("Delay with jitter = %s, want [100ms, 150ms)", delay)
+		}
+	}
+}
+
+// Retry-After支持秒数与HTTP日期，RespectRetryAfter为false或无法解析时使用退避时间
+func TestRetryDelayRetryAfter(t *testing.T) {
+	retry := &Retry{BackoffFactor: 100 * time.Millisecond, RespectRetryAfter: true}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{value: " 0 ", min: 0, max: 0},
+		{value: "-5", min: 0, max: 0},
+		{value: date, min: 8 * time.Second, max: 10 * time.Second},
+		{value: "Mon, 02 Jan 2006 15:04:05 GMT", min: 0, max: 0},
+		{value: "soon", min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+		{value: "", min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		delay := retry.Delay(1, http.Header{"Retry-After": {test.value}})
+		if delay < test.min || delay > test.max {
+			t.Errorf("Retry-After %q: delay = %s, want [%s, %s]", test.value, delay, test.min, test.max)
+		}
+	}
+	retry.RespectRetryAfter = false
+	if delay := retry.Delay(1, http.Header{"Retry-After": {"3"}}); delay != 100*time.Millisecond {
+		t.Errorf("ignored Retry-After: delay = %s, want 100ms", delay)
+	}
+}
+
+func TestRetryAllow(t *testing.T) {
+	retry := NewRetry()
+	if !retry.AllowMethod("get") || retry.AllowMethod(http.MethodPost) {
+		t.Error("default methods should allow GET and not POST")
+	}
+	retry.Methods = []string{http.MethodPost}
+	if !retry.AllowMethod(http.MethodPost) || retry.AllowMethod(http.MethodGet) {
+		t.Error("Methods should replace the default methods")
+	}
+	if !retry.AllowStatus(503) || retry.AllowStatus(404) {
+		t.Error("default status codes should include 503 and not 404")
+	}
+}
@@ -0,0 +1,30 @@
+package url
+
+import (
+	"crypto/x509"
+)
+
+// TLS配置，CA证书与客户端证书均可从文件或内存中加载
+type TLSConfig struct {
+	InsecureSkipVerify bool   // 跳过服务器证书校验
+	ServerName         string // 校验证书时使用的主机名，为空时使用请求地址的主机名
+
+	RootCAFile     string // PEM格式的CA证书文件
+	RootCAs        []byte // PEM格式的CA证书内容
+	UseSystemRoots bool   // 设置RootCAFile或RootCAs时仍信任系统CA证书，未设置时总是使用系统CA证书
+
+	ClientCertFile string // PEM格式的客户端证书文件
+	ClientKeyFile  string // PEM格式的客户端私钥文件
+	ClientCert     []byte // PEM格式的客户端证书内容
+	ClientKey      []byte // PEM格式的客户端私钥内容
+	PKCS12File     string // PKCS#12格式的客户端证书文件
+	PKCS12         []byte // PKCS#12格式的客户端证书内容
+	PKCS12Password string // PKCS#12密码
+
+	// 证书公钥固定，值为证书SubjectPublicKeyInfo的SHA256摘要的Base64编码，可带"sha256/"前缀，
+	// 证书链中任意一个证书匹配即可通过
+	PinnedSPKI []string
+
+	// 自定义证书校验，在默认校验之后调用，跳过证书校验时verifiedChains为nil
+	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error `json:"-"`
+}
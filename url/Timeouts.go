@@ -0,0 +1,72 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 超时的阶段
+type TimeoutPhase string
+
+const (
+	TimeoutConnect        TimeoutPhase = "connect"         // 建立连接，包含DNS解析与代理隧道
+	TimeoutTLSHandshake   TimeoutPhase = "tls handshake"   // TLS握手
+	TimeoutResponseHeader TimeoutPhase = "response header" // 等待响应头
+	TimeoutBodyIdle       TimeoutPhase = "body idle"       // 读取响应体时等待数据
+	TimeoutTotal          TimeoutPhase = "total"           // 整个请求
+)
+
+// 分阶段的超时设置，只作用于当次请求，为0的字段不限制（Total为0时使用默认的30秒）
+type Timeouts struct {
+	Connect        time.Duration // 建立连接的超时，包含DNS解析与代理隧道
+	TLSHandshake   time.Duration // TLS握手的超时
+	ResponseHeader time.Duration // 从开始请求到收到响应头的超时，包含建立连接与重定向
+	BodyIdle       time.Duration // 读取响应体时两次收到数据之间的最长间隔
+	Total          time.Duration // 整个请求的超时，包含重定向与读取响应体；流式响应收到响应头后停止计时，读取Body只受BodyIdle限制
+}
+
+// 合并超时设置，other中不为0的字段覆盖t中的字段
+func (t Timeouts) Merge(other *Timeouts) Timeouts {
+	if other == nil {
+		return t
+	}
+	if other.Connect != 0 {
+		t.Connect = other.Connect
+	}
+	if other.TLSHandshake != 0 {
+		t.TLSHandshake = other.TLSHandshake
+	}
+	if other.ResponseHeader != 0 {
+		t.ResponseHeader = other.ResponseHeader
+	}
+	if other.BodyIdle != 0 {
+		t.BodyIdle = other.BodyIdle
+	}
+	if other.Total != 0 {
+		t.Total = other.Total
+	}
+	return t
+}
+
+// 超时错误，Phase表示超时的阶段，可用errors.As获取，errors.Is(err, context.DeadlineExceeded)为true
+type TimeoutError struct {
+	Phase    TimeoutPhase
+	Duration time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout exceeded after %s", e.Phase, e.Duration)
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}